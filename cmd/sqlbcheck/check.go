@@ -0,0 +1,593 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitranim/sqlb"
+)
+
+const sqlbPath = `github.com/mitranim/sqlb`
+
+// Single problem found in a query.
+type Diag struct {
+	Pos token.Position
+	Msg string
+}
+
+// Implement `fmt.Stringer`, using the format "file:line:column: message".
+func (self Diag) String() string { return fmt.Sprintf(`%v: %v`, self.Pos, self.Msg) }
+
+/*
+Parses and checks all Go files in the given directory, non-recursively.
+Regular files and external test files ("_test" packages) are type-checked
+separately. Type errors, including failures to import dependencies, are
+ignored: type information is used only when available.
+*/
+func CheckDir(dir string, unused bool) ([]Diag, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	pkgs := map[string][]*ast.File{}
+	var names []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, `.go`) {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		pkg := file.Name.Name
+		if pkgs[pkg] == nil {
+			names = append(names, pkg)
+		}
+		pkgs[pkg] = append(pkgs[pkg], file)
+	}
+
+	sort.Strings(names)
+
+	var out []Diag
+	for _, name := range names {
+		out = append(out, CheckFiles(fset, pkgs[name], unused)...)
+	}
+	return out, nil
+}
+
+/*
+Checks the given files, which must belong to the same package. If "unused" is
+true, arguments not used by any parameter are reported, mirroring
+`sqlb.ValidateUnusedArguments`.
+*/
+func CheckFiles(fset *token.FileSet, files []*ast.File, unused bool) []Diag {
+	info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, `source`, nil),
+		Error:    func(error) {},
+	}
+	if len(files) > 0 {
+		_, _ = conf.Check(files[0].Name.Name, fset, files, info)
+	}
+
+	state := checker{fset: fset, info: info, unused: unused}
+	for _, file := range files {
+		state.file(file)
+	}
+
+	sort.SliceStable(state.diags, func(one, two int) bool {
+		return posLess(state.diags[one].Pos, state.diags[two].Pos)
+	})
+	return state.diags
+}
+
+type checker struct {
+	fset    *token.FileSet
+	info    *types.Info
+	unused  bool
+	imports map[string]bool
+	diags   []Diag
+}
+
+type argsKind byte
+
+const (
+	argsUnknown argsKind = iota
+	argsNone
+	argsList
+	argsDict
+	argsStruct
+	argsTemplate
+)
+
+/*
+Statically known arguments of a query. `.count` is used for lists, and `.keys`
+for dicts and structs. `.lax` disables reporting of unused arguments, just
+like for `sqlb.LaxDict` and `sqlb.StructDict`.
+*/
+type queryArgs struct {
+	kind  argsKind
+	count int
+	keys  map[string]bool
+	lax   bool
+}
+
+func (self *checker) file(file *ast.File) {
+	self.imports = map[string]bool{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if path != sqlbPath {
+			continue
+		}
+		if spec.Name != nil {
+			self.imports[spec.Name.Name] = true
+		} else {
+			self.imports[`sqlb`] = true
+		}
+	}
+	if len(self.imports) <= 0 {
+		return
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.CallExpr:
+			self.call(node)
+		case *ast.CompositeLit:
+			self.lit(node)
+		}
+		return true
+	})
+}
+
+func (self *checker) call(node *ast.CallExpr) {
+	if len(node.Args) <= 0 {
+		return
+	}
+	query := node.Args[0]
+
+	switch self.sqlbName(node.Fun) {
+	case `Preparse`:
+		self.check(query, queryArgs{})
+
+	case `ListQ`:
+		count := len(node.Args) - 1
+		switch {
+		case node.Ellipsis.IsValid():
+			self.check(query, queryArgs{})
+		case count <= 0:
+			self.check(query, queryArgs{kind: argsNone})
+		default:
+			self.check(query, queryArgs{kind: argsList, count: count})
+		}
+
+	case `DictQ`:
+		if len(node.Args) != 2 {
+			return
+		}
+		args := self.dictArgs(node.Args[1])
+		if args.kind == argsDict && len(args.keys) <= 0 {
+			args.kind = argsNone
+		}
+		self.check(query, args)
+
+	case `StructQ`:
+		if len(node.Args) != 2 {
+			return
+		}
+		self.check(query, self.structArgs(node.Args[1]))
+
+	default:
+		self.template(node)
+	}
+}
+
+// Handles `sqlb.NewTemplate[Type](text)`.
+func (self *checker) template(node *ast.CallExpr) {
+	index, _ := node.Fun.(*ast.IndexExpr)
+	if index == nil || self.sqlbName(index.X) != `NewTemplate` {
+		return
+	}
+
+	args := queryArgs{kind: argsTemplate, keys: map[string]bool{}}
+	typ := self.typeOf(index.Index)
+	if typ == nil {
+		self.check(node.Args[0], queryArgs{})
+		return
+	}
+
+	struc, _ := typ.Underlying().(*types.Struct)
+	if struc == nil {
+		self.check(node.Args[0], queryArgs{})
+		return
+	}
+
+	addStructFields(args.keys, struc, true)
+	self.check(node.Args[0], args)
+}
+
+// Handles `sqlb.StrQ{text, args}`.
+func (self *checker) lit(node *ast.CompositeLit) {
+	if self.sqlbName(node.Type) != `StrQ` {
+		return
+	}
+
+	var query, dict ast.Expr
+	for ind, elem := range node.Elts {
+		pair, _ := elem.(*ast.KeyValueExpr)
+		if pair == nil {
+			if ind == 0 {
+				query = elem
+			} else if ind == 1 {
+				dict = elem
+			}
+			continue
+		}
+
+		key, _ := pair.Key.(*ast.Ident)
+		if key == nil {
+			continue
+		}
+		if key.Name == `Text` {
+			query = pair.Value
+		} else if key.Name == `Args` {
+			dict = pair.Value
+		}
+	}
+
+	if query == nil {
+		return
+	}
+	self.check(query, self.strqArgs(dict))
+}
+
+func (self *checker) strqArgs(expr ast.Expr) queryArgs {
+	if expr == nil || isNilIdent(expr) {
+		return queryArgs{kind: argsNone}
+	}
+
+	lit, _ := unparen(expr).(*ast.CompositeLit)
+	if lit == nil {
+		return queryArgs{}
+	}
+
+	switch self.sqlbName(lit.Type) {
+	case `List`:
+		for _, elem := range lit.Elts {
+			if _, ok := elem.(*ast.KeyValueExpr); ok {
+				return queryArgs{}
+			}
+		}
+		return queryArgs{kind: argsList, count: len(lit.Elts)}
+
+	case `Dict`:
+		return self.dictArgs(lit)
+
+	case `LaxDict`:
+		out := self.dictArgs(lit)
+		out.lax = true
+		return out
+
+	default:
+		return queryArgs{}
+	}
+}
+
+// Supports map literals with constant string keys.
+func (self *checker) dictArgs(expr ast.Expr) queryArgs {
+	if isNilIdent(expr) {
+		return queryArgs{kind: argsNone}
+	}
+
+	lit, _ := unparen(expr).(*ast.CompositeLit)
+	if lit == nil {
+		return queryArgs{}
+	}
+
+	out := queryArgs{kind: argsDict, keys: map[string]bool{}}
+	for _, elem := range lit.Elts {
+		pair, _ := elem.(*ast.KeyValueExpr)
+		if pair == nil {
+			return queryArgs{}
+		}
+
+		key, ok := self.stringOf(pair.Key)
+		if !ok {
+			return queryArgs{}
+		}
+		out.keys[key] = true
+	}
+	return out
+}
+
+/*
+Mirrors `sqlb.StructDict`, which supports public fields, including fields of
+embedded structs, and public methods. Unused fields are not reported, because
+`sqlb.StructDict` doesn't validate them.
+*/
+func (self *checker) structArgs(expr ast.Expr) queryArgs {
+	if isNilIdent(expr) {
+		return queryArgs{kind: argsNone}
+	}
+
+	typ := self.typeOf(expr)
+	if typ == nil {
+		return queryArgs{}
+	}
+
+	if ptr, _ := typ.(*types.Pointer); ptr != nil {
+		typ = ptr.Elem()
+	}
+
+	struc, _ := typ.Underlying().(*types.Struct)
+	if struc == nil {
+		return queryArgs{}
+	}
+
+	out := queryArgs{kind: argsStruct, keys: map[string]bool{}, lax: true}
+	addStructFields(out.keys, struc, false)
+
+	methods := types.NewMethodSet(typ)
+	for ind := 0; ind < methods.Len(); ind++ {
+		obj := methods.At(ind).Obj()
+		if obj.Exported() {
+			out.keys[obj.Name()] = true
+		}
+	}
+	return out
+}
+
+/*
+Adds the names of public fields, including fields of embedded structs. When
+"leaves" is true, embedded structs themselves are excluded, matching the
+validation performed by `sqlb.NewTemplate`.
+*/
+func addStructFields(buf map[string]bool, typ *types.Struct, leaves bool) {
+	for ind := 0; ind < typ.NumFields(); ind++ {
+		field := typ.Field(ind)
+		if !field.Exported() {
+			continue
+		}
+
+		var inner *types.Struct
+		if field.Embedded() {
+			inner = structOf(field.Type())
+		}
+
+		if inner == nil || !leaves {
+			buf[field.Name()] = true
+		}
+		if inner != nil {
+			addStructFields(buf, inner, leaves)
+		}
+	}
+}
+
+func structOf(typ types.Type) *types.Struct {
+	if ptr, _ := typ.(*types.Pointer); ptr != nil {
+		typ = ptr.Elem()
+	}
+	out, _ := typ.Underlying().(*types.Struct)
+	return out
+}
+
+/*
+Parses the query and compares its parameters with the given arguments, in the
+same way as `sqlb.Prep` does at runtime. Queries whose text isn't a constant
+are skipped.
+*/
+func (self *checker) check(expr ast.Expr, args queryArgs) {
+	text, ok := self.stringOf(expr)
+	if !ok {
+		return
+	}
+
+	prep, err := parsePrep(text)
+	if err != nil {
+		self.report(expr, `malformed query: %v`, err)
+		return
+	}
+
+	if args.kind == argsUnknown {
+		return
+	}
+
+	if !prep.HasParams && args.kind != argsTemplate {
+		if args.kind != argsNone {
+			self.report(expr, `non-parametrized query expected no arguments`)
+		}
+		return
+	}
+
+	if args.kind == argsNone {
+		self.report(expr, `parametrized query expected arguments, got none`)
+		return
+	}
+
+	ordinals := map[int]bool{}
+	named := map[string]bool{}
+
+	for _, tok := range prep.Tokens {
+		switch tok.Type {
+		case sqlb.TokenTypeOrdinalParam:
+			param := tok.ParseOrdinalParam()
+			ordinals[param.Index()] = true
+
+			if args.kind == argsTemplate {
+				self.reportAt(expr, tok.Pos, `unsupported ordinal parameter %q; templates support only named parameters`, param)
+			} else if args.kind != argsList || param.Index() >= args.count {
+				self.reportAt(expr, tok.Pos, `missing ordinal argument %q (index %v)`, param, param.Index())
+			}
+
+		case sqlb.TokenTypeNamedParam:
+			param := tok.ParseNamedParam()
+
+			// Mirrors the fallback from ":alias.col" to ":alias" in `sqlb.StrQ`.
+			if head, rest := param.SplitPath(); rest != `` && !args.keys[param.Key()] && args.keys[head.Key()] {
+				param = head
+			}
+			named[param.Key()] = true
+
+			if !args.keys[param.Key()] {
+				self.reportAt(expr, tok.Pos, `missing named argument %q (key %q)`, param, param.Key())
+			}
+		}
+	}
+
+	if args.kind == argsTemplate {
+		for _, key := range sortedKeys(args.keys) {
+			if !named[key] {
+				self.report(expr, `field %q is not used by any named parameter`, key)
+			}
+		}
+		return
+	}
+
+	if !self.unused || args.lax {
+		return
+	}
+
+	for ind := 0; ind < args.count; ind++ {
+		if !ordinals[ind] {
+			self.report(expr, `unused ordinal argument %q (index %v)`, sqlb.OrdinalParam(ind+1), ind)
+		}
+	}
+
+	for _, key := range sortedKeys(args.keys) {
+		if !named[key] {
+			self.report(expr, `unused named argument %q (key %q)`, sqlb.NamedParam(key), key)
+		}
+	}
+}
+
+func (self *checker) report(expr ast.Expr, msg string, args ...any) {
+	self.diags = append(self.diags, Diag{
+		Pos: self.fset.Position(expr.Pos()),
+		Msg: fmt.Sprintf(msg, args...),
+	})
+}
+
+/*
+Reports a problem at the given position in the query text. For raw string
+literals, whose text is identical to the source code, the diagnostic points
+directly at the parameter. Otherwise it points at the query, and the message
+includes the position within the query.
+*/
+func (self *checker) reportAt(expr ast.Expr, pos sqlb.TokenPos, msg string, args ...any) {
+	lit, _ := unparen(expr).(*ast.BasicLit)
+	if lit != nil && strings.HasPrefix(lit.Value, "`") && !strings.Contains(lit.Value, "\r") {
+		self.diags = append(self.diags, Diag{
+			Pos: self.fset.Position(lit.Pos() + 1 + token.Pos(pos.Offset)),
+			Msg: fmt.Sprintf(msg, args...),
+		})
+		return
+	}
+	self.report(expr, msg+` at query %v`, append(args, pos)...)
+}
+
+/*
+Returns the name of the "sqlb" declaration referenced by the given expression,
+such as "StrQ" for "sqlb.StrQ", or an empty string.
+*/
+func (self *checker) sqlbName(expr ast.Expr) string {
+	sel, _ := expr.(*ast.SelectorExpr)
+	if sel == nil {
+		return ``
+	}
+	pkg, _ := sel.X.(*ast.Ident)
+	if pkg == nil || !self.imports[pkg.Name] {
+		return ``
+	}
+	return sel.Sel.Name
+}
+
+func (self *checker) stringOf(expr ast.Expr) (string, bool) {
+	val := self.info.Types[expr].Value
+	if val != nil && val.Kind() == constant.String {
+		return constant.StringVal(val), true
+	}
+
+	lit, _ := unparen(expr).(*ast.BasicLit)
+	if lit == nil || lit.Kind != token.STRING {
+		return ``, false
+	}
+
+	out, err := strconv.Unquote(lit.Value)
+	return out, err == nil
+}
+
+func (self *checker) typeOf(expr ast.Expr) types.Type {
+	typ := self.info.Types[expr].Type
+	if typ == nil {
+		return nil
+	}
+	if basic, _ := typ.(*types.Basic); basic != nil && basic.Kind() == types.Invalid {
+		return nil
+	}
+	return typ
+}
+
+func parsePrep(src string) (out sqlb.Prep, err error) {
+	defer func() {
+		val := recover()
+		if val == nil {
+			return
+		}
+		cause, ok := val.(error)
+		if !ok {
+			panic(val)
+		}
+		err = cause
+	}()
+
+	out.Source = src
+	out.Parse()
+	return
+}
+
+func isNilIdent(expr ast.Expr) bool {
+	ident, _ := unparen(expr).(*ast.Ident)
+	return ident != nil && ident.Name == `nil`
+}
+
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		paren, _ := expr.(*ast.ParenExpr)
+		if paren == nil {
+			return expr
+		}
+		expr = paren.X
+	}
+}
+
+func sortedKeys(src map[string]bool) []string {
+	out := make([]string, 0, len(src))
+	for key := range src {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func posLess(one, two token.Position) bool {
+	if one.Filename != two.Filename {
+		return one.Filename < two.Filename
+	}
+	return one.Offset < two.Offset
+}
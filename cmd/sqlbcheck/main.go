@@ -0,0 +1,124 @@
+/*
+Command "sqlbcheck" statically validates query strings passed to "sqlb" in Go
+source code, catching errors that would otherwise be detected only at runtime,
+such as `sqlb.ErrMissingArgument` and `sqlb.ErrUnusedArgument`. Intended for
+CI. Usage:
+
+	go run github.com/mitranim/sqlb/cmd/sqlbcheck ./...
+
+Arguments are directories, optionally suffixed with "/..." to include
+subdirectories. The default is the current directory. Test files are included.
+
+The following expressions are checked, when the query text is a string literal
+or a string constant:
+
+	* `sqlb.ListQ(text, args...)`: ordinal parameters vs argument count.
+	* `sqlb.DictQ(text, args)`: named parameters vs keys of a map literal.
+	* `sqlb.StructQ(text, args)`: named parameters vs fields and methods.
+	* `sqlb.StrQ{text, args}` where args is a literal `sqlb.List`,
+	  `sqlb.Dict`, or `sqlb.LaxDict`, or nil.
+	* `sqlb.NewTemplate[Type](text)`: named parameters vs fields.
+	* `sqlb.Preparse(text)`: only syntax.
+
+Any query which fails to tokenize is reported as malformed. Arguments which
+can't be determined statically, such as variables or spread slices, are not
+checked; the query is still checked for syntax. Diagnostics are printed to
+stdout in the format "file:line:column: message". The exit code is 1 when any
+problems are found, and 2 when the input can't be read.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var flagUnused = flag.Bool(
+	`unused`,
+	true,
+	`report unused arguments, mirroring "sqlb.ValidateUnusedArguments"`,
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: sqlbcheck [flags] [dir | dir/...]...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) <= 0 {
+		args = []string{`.`}
+	}
+
+	var diags []Diag
+	for _, arg := range args {
+		dirs, err := expandDirs(arg)
+		if err != nil {
+			fail(err)
+		}
+
+		for _, dir := range dirs {
+			val, err := CheckDir(dir, *flagUnused)
+			if err != nil {
+				fail(err)
+			}
+			diags = append(diags, val...)
+		}
+	}
+
+	for _, val := range diags {
+		fmt.Println(val)
+	}
+	if len(diags) > 0 {
+		os.Exit(1)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "sqlbcheck: %v\n", err)
+	os.Exit(2)
+}
+
+/*
+Converts a command line argument into a list of directories. A "/..." suffix
+includes all subdirectories, skipping "testdata", "vendor", and directories
+whose names begin with "." or "_", just like the "go" tool.
+*/
+func expandDirs(src string) ([]string, error) {
+	root := strings.TrimSuffix(src, `/...`)
+	if root == src {
+		return []string{src}, nil
+	}
+	if root == `` {
+		root = `.`
+	}
+
+	var out []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != root && isDirIgnored(entry.Name()) {
+			return filepath.SkipDir
+		}
+		out = append(out, path)
+		return nil
+	})
+
+	sort.Strings(out)
+	return out, err
+}
+
+func isDirIgnored(name string) bool {
+	return name == `testdata` || name == `vendor` ||
+		strings.HasPrefix(name, `.`) || strings.HasPrefix(name, `_`)
+}
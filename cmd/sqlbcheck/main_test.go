@@ -0,0 +1,116 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const testSrc = "package example\n" + `
+import s "github.com/mitranim/sqlb"
+
+const queryConst = ` + "`select :one`" + `
+
+type Args struct {
+	Id   int64
+	Name string
+}
+
+type Nested struct {
+	Args
+	Extra string
+}
+
+func (Args) Method() string { return "" }
+
+func example(dynamic string, list []any) {
+	_ = s.ListQ(` + "`select $1, $2`" + `, 10, 20)
+	_ = s.ListQ(` + "`select $1, $3`" + `, 10, 20)
+	_ = s.ListQ(` + "`select $1`" + `, 10, 20)
+	_ = s.ListQ(` + "`select $1`" + `, list...)
+	_ = s.ListQ(` + "`select $1`" + `)
+	_ = s.ListQ(` + "`select 1`" + `, 10)
+	_ = s.ListQ(dynamic, 10)
+
+	_ = s.DictQ(queryConst, map[string]any{"one": 10})
+	_ = s.DictQ(queryConst, map[string]any{"two": 10})
+	_ = s.DictQ("select :one,\n:two", s.Dict{"one": 10})
+	_ = s.DictQ(queryConst, nil)
+
+	_ = s.StructQ(` + "`select :Id, :Name, :Method`" + `, Args{})
+	_ = s.StructQ(` + "`select :Id, :Extra, :Other`" + `, &Nested{})
+
+	_ = s.StrQ{` + "`select :one, :two`" + `, s.Dict{"one": 10, "two": 20}}
+	_ = s.StrQ{Args: s.LaxDict{"one": 10, "two": 20}, Text: queryConst}
+	_ = s.StrQ{` + "`select :one`" + `, s.List{10}}
+	_ = s.StrQ{` + "`select 'unclosed`" + `, nil}
+	_ = s.StrQ{` + "`select :alias.col from :alias`" + `, s.Dict{"alias": s.Ident("t")}}
+
+	_ = s.Preparse(` + "`select /* unclosed`" + `)
+
+	_ = s.NewTemplate[Nested](` + "`select :Id, :Name, :Extra`" + `)
+	_ = s.NewTemplate[Nested](` + "`select :Id, :Name, $1`" + `)
+}
+`
+
+func TestCheckFiles(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, `example.go`, testSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, val := range CheckFiles(fset, []*ast.File{file}, true) {
+		lines = append(lines, val.String())
+	}
+
+	exp := []string{
+		`example.go:21:14: unused ordinal argument "$2" (index 1)`,
+		`example.go:21:26: missing ordinal argument "$3" (index 2)`,
+		`example.go:22:14: unused ordinal argument "$2" (index 1)`,
+		`example.go:24:14: parametrized query expected arguments, got none`,
+		`example.go:25:14: non-parametrized query expected no arguments`,
+		`example.go:29:14: missing named argument ":one" (key "one") at query line 1, column 8`,
+		`example.go:29:14: unused named argument ":two" (key "two")`,
+		`example.go:30:14: missing named argument ":two" (key "two") at query line 2, column 1`,
+		`example.go:31:14: parametrized query expected arguments, got none`,
+		`example.go:34:37: missing named argument ":Other" (key "Other")`,
+		`example.go:38:13: unused ordinal argument "$1" (index 0)`,
+		`example.go:38:21: missing named argument ":one" (key "one")`,
+		`example.go:39:13: malformed query: `,
+		`example.go:42:17: malformed query: `,
+		`example.go:45:28: field "Extra" is not used by any named parameter`,
+		`example.go:45:48: unsupported ordinal parameter "$1"; templates support only named parameters`,
+	}
+
+	if len(lines) != len(exp) {
+		t.Fatalf("expected %v diagnostics, got %v:\n%v", len(exp), len(lines), strings.Join(lines, "\n"))
+	}
+
+	for ind, line := range lines {
+		if !strings.HasPrefix(line, exp[ind]) {
+			t.Errorf("diagnostic %v:\nexpected prefix: %v\nactual: %v", ind, exp[ind], line)
+		}
+	}
+}
+
+func TestExpandDirs(t *testing.T) {
+	out, err := expandDirs(`.`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != `.` {
+		t.Fatalf(`unexpected %q`, out)
+	}
+
+	out, err = expandDirs(`./...`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != `.` {
+		t.Fatalf(`unexpected %q`, out)
+	}
+}
@@ -84,6 +84,17 @@ type NamedRanger interface {
 	RangeNamed(func(string))
 }
 
+/*
+Optional interface for struct types used with `ParserOrds` and `OrdsParser`.
+Allows clients to order by computed expressions, such as `lower(name)` or a
+full-text rank, selected by name. The parser resolves these names alongside
+JSON field paths, still rejecting unknown names. Struct fields take priority
+over expressions with the same name. Names must be valid ordering paths: one
+or more dot-separated identifiers. The parser calls this method on a zero
+value of the struct type, once per type, and caches the result.
+*/
+type OrdExprer interface{ OrdExprs() map[string]Expr }
+
 /*
 Used by `Partial` for filtering struct fields. See `Sparse` and `Partial` for
 explanations.
@@ -47,6 +47,9 @@ func (self Bui) Reify() (string, []any) {
 	return self.String(), self.Args
 }
 
+// Shortcut for `InlineArgs(self.Reify())`. Meant only for debugging.
+func (self Bui) ReifyDebug() string { return InlineArgs(self.Reify()) }
+
 // Returns inner text as a string, performing a free cast.
 func (self Bui) String() string {
 	return bytesToMutableString(self.Text)
@@ -0,0 +1,202 @@
+package sqlb
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"math"
+	r "reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Marker prepended to the output of `InlineArgs`, `ReifyDebug`, and
+`(Bui).ReifyDebug`. The output is meant for reading and for pasting into an
+interactive SQL shell such as "psql". It must never be executed by programs:
+inlined arguments are not a substitute for parameters, and the encoding is
+best-effort.
+*/
+const DebugMarker = `/* sqlb debug: arguments inlined, unsafe for execution */ `
+
+/*
+Verbose mode for the `fmt.Stringer` implementation of the inner expression.
+Renders exactly like the inner expression, but `String` returns the output of
+`ReifyDebug`, with arguments inlined as SQL literals, instead of only the query
+text with ordinal parameters such as "$1". Applies only to this value, and is
+safe to use concurrently with any other rendering. Meant for debugging, for
+example in log statements. Usage:
+
+	log.Println(Verbose{expr})
+*/
+type Verbose [1]Expr
+
+// Implement the `Expr` interface, making this a sub-expression.
+func (self Verbose) AppendExpr(text []byte, args []any) ([]byte, []any) {
+	bui := Bui{text, args}
+	bui.Expr(self[0])
+	return bui.Get()
+}
+
+// Implement the `AppenderTo` interface, sometimes allowing more efficient text
+// encoding.
+func (self Verbose) AppendTo(text []byte) []byte { return exprAppend(self, text) }
+
+// Implement the `fmt.Stringer` interface, returning the output of `ReifyDebug`.
+func (self Verbose) String() string { return ReifyDebug(self[0]) }
+
+// Shortcut for `InlineArgs(Reify(vals...))`.
+func ReifyDebug(vals ...Expr) string { return InlineArgs(Reify(vals...)) }
+
+/*
+Debug rendering. Replaces ordinal parameters such as "$1" in the given text with
+the corresponding arguments, encoded as SQL literals, and prepends
+`DebugMarker`. Uses `Tokenizer` to find parameters, ignoring any "$1" in quoted
+strings or comments. Parameters without a corresponding argument are left
+as-is. Encoding rules:
+
+	* Nil and values implementing `Nullable` with `.IsNull() == true` become
+	  "null".
+	* `driver.Valuer` is called, and its result is encoded. This includes
+	  `ArrayAppender`, which becomes a string literal such as '{10,20}'.
+	* Strings become single-quoted literals with doubled quotes.
+	* Byte slices become hex-encoded "bytea" literals such as '\x0a0b'.
+	* Times become quoted RFC 3339 timestamps.
+	* Booleans and numbers are encoded as-is. Negative numbers are
+	  parenthesized, and non-finite floats are quoted.
+	* Other `AppenderTo` or `fmt.Stringer` values, and anything else, become
+	  string literals.
+*/
+func InlineArgs(text string, args []any) string {
+	buf := make([]byte, 0, len(DebugMarker)+len(text)+len(args)*8)
+	buf = append(buf, DebugMarker...)
+
+	tok := Tokenizer{Source: text}
+	for {
+		val := tok.Next()
+		if val.IsInvalid() {
+			break
+		}
+
+		if val.Type == TokenTypeOrdinalParam {
+			ind := val.ParseOrdinalParam().Index()
+			if ind >= 0 && ind < len(args) {
+				buf = appendDebugLiteral(buf, args[ind])
+				continue
+			}
+		}
+		buf = append(buf, val.Text...)
+	}
+	return bytesToMutableString(buf)
+}
+
+func appendDebugLiteral(buf []byte, src any) []byte {
+	src = normNil(src)
+	if src == nil {
+		return append(buf, `null`...)
+	}
+
+	nullable, _ := src.(Nullable)
+	if nullable != nil && nullable.IsNull() {
+		return append(buf, `null`...)
+	}
+
+	valuer, _ := src.(driver.Valuer)
+	if valuer != nil {
+		val, err := valuer.Value()
+		if err != nil {
+			buf = append(buf, `null /* `...)
+			buf = append(buf, strings.ReplaceAll(strconv.Quote(err.Error()), `*/`, `* /`)...)
+			return append(buf, ` */`...)
+		}
+
+		// Guards against valuers that return themselves.
+		if _, ok := val.(driver.Valuer); !ok {
+			return appendDebugLiteral(buf, val)
+		}
+		src = val
+	}
+
+	switch val := src.(type) {
+	case string:
+		return appendDebugString(buf, val)
+	case []byte:
+		buf = append(buf, `'\x`...)
+		buf = append(buf, hex.EncodeToString(val)...)
+		return append(buf, `'`...)
+	case time.Time:
+		return appendDebugString(buf, val.Format(time.RFC3339Nano))
+	case AppenderTo:
+		return appendDebugString(buf, bytesToMutableString(val.AppendTo(nil)))
+	case fmt.Stringer:
+		return appendDebugString(buf, val.String())
+	}
+
+	val := r.ValueOf(src)
+
+	switch val.Kind() {
+	case r.Ptr:
+		return appendDebugLiteral(buf, val.Elem().Interface())
+	case r.Bool:
+		return strconv.AppendBool(buf, val.Bool())
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		return appendDebugInt(buf, val.Int())
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		return strconv.AppendUint(buf, val.Uint(), 10)
+	case r.Float32, r.Float64:
+		return appendDebugFloat(buf, val.Float())
+	case r.String:
+		return appendDebugString(buf, val.String())
+	case r.Slice:
+		if val.Type().Elem().Kind() == r.Uint8 {
+			return appendDebugLiteral(buf, val.Bytes())
+		}
+		return appendDebugString(buf, fmt.Sprint(src))
+	default:
+		return appendDebugString(buf, fmt.Sprint(src))
+	}
+}
+
+/*
+Negative numbers are parenthesized, because "-" preceded by another "-" would
+begin a comment.
+*/
+func appendDebugInt(buf []byte, val int64) []byte {
+	if val < 0 {
+		buf = append(buf, `(`...)
+		buf = strconv.AppendInt(buf, val, 10)
+		return append(buf, `)`...)
+	}
+	return strconv.AppendInt(buf, val, 10)
+}
+
+func appendDebugFloat(buf []byte, val float64) []byte {
+	if math.IsNaN(val) {
+		return append(buf, `'NaN'`...)
+	}
+	if math.IsInf(val, 1) {
+		return append(buf, `'Infinity'`...)
+	}
+	if math.IsInf(val, -1) {
+		return append(buf, `'-Infinity'`...)
+	}
+	if val < 0 {
+		buf = append(buf, `(`...)
+		buf = strconv.AppendFloat(buf, val, 'g', -1, 64)
+		return append(buf, `)`...)
+	}
+	return strconv.AppendFloat(buf, val, 'g', -1, 64)
+}
+
+func appendDebugString(buf []byte, val string) []byte {
+	buf = append(buf, quoteSingle)
+	for ind := 0; ind < len(val); ind++ {
+		char := val[ind]
+		if char == quoteSingle {
+			buf = append(buf, quoteSingle)
+		}
+		buf = append(buf, char)
+	}
+	return append(buf, quoteSingle)
+}
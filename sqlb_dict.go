@@ -147,3 +147,388 @@ func (self StructDict) GotNamed(key string) (any, bool) {
 
 	return nil, false
 }
+
+/*
+Determines how `PathDict` maps names in parameters such as ":one.two" to struct
+fields:
+
+	* `FieldNamingGo`: Go field names, such as ":SomeField". Also supports
+	  public methods without arguments, like `StructDict`. This is the default.
+	* `FieldNamingDb`: names from "db" tags, following `FieldDbName`.
+	* `FieldNamingJson`: names from "json" tags, following the conventions of
+	  the "encoding/json" package: fields without tags use Go names.
+
+Fields of embedded structs are accessible without a path prefix, following the
+conventions of each naming mode.
+*/
+type FieldNaming byte
+
+const (
+	FieldNamingGo FieldNaming = iota
+	FieldNamingDb
+	FieldNamingJson
+)
+
+/*
+Implements `ArgDict` by resolving named parameters as dotted paths through
+structs and maps. For example, ":filter.min_age" reads the "filter" field or
+key, then its "min_age" field or key. The inner value may be nil, a struct, or
+a map with string keys, possibly behind pointers or interfaces, and the same
+applies to intermediary values in a path. `.Naming` determines how path
+segments are matched to struct fields. Supports only named parameters, not
+ordinal parameters. Usage:
+
+	StrQ{
+		`select * from persons where age >= :filter.min_age`,
+		PathDict{Val: args, Naming: FieldNamingDb},
+	}
+
+If an intermediary value in a path is nil, the parameter is considered present,
+with a nil value. Implements `NamedRanger`, which allows to detect unused
+arguments. Only the top-level names are validated: a top-level field or key is
+considered used when any path through it is used.
+*/
+type PathDict struct {
+	Val    any
+	Naming FieldNaming
+}
+
+// Implement part of the `ArgDict` interface.
+func (self PathDict) IsEmpty() bool {
+	val := valueDerefAny(r.ValueOf(self.Val))
+	switch val.Kind() {
+	case r.Struct:
+		return isStructTypeEmpty(val.Type())
+	case r.Map:
+		return val.Len() <= 0
+	default:
+		return true
+	}
+}
+
+// Implement part of the `ArgDict` interface. Always returns 0.
+func (self PathDict) Len() int { return 0 }
+
+// Implement `pathArgDict`. See `gotNamedPath`.
+func (self PathDict) resolvesPaths() bool { return true }
+
+// Implement part of the `ArgDict` interface. Always returns `nil, false`.
+func (self PathDict) GotOrdinal(int) (any, bool) { return nil, false }
+
+// Implement part of the `ArgDict` interface.
+func (self PathDict) GotNamed(key string) (any, bool) {
+	val := valueDerefAny(r.ValueOf(self.Val))
+	if !val.IsValid() {
+		return nil, false
+	}
+
+	for len(key) > 0 {
+		var head string
+		head, key = splitPathHead(key)
+
+		var ok bool
+		val, ok = self.child(val, head)
+		if !ok {
+			return nil, false
+		}
+
+		if len(key) > 0 {
+			val = valueDerefAny(val)
+			if !val.IsValid() {
+				return nil, true
+			}
+		}
+	}
+
+	if !val.IsValid() {
+		return nil, true
+	}
+	return val.Interface(), true
+}
+
+// Implement `NamedRanger` to automatically validate used/unused arguments.
+func (self PathDict) RangeNamed(fun func(string)) {
+	if fun == nil {
+		return
+	}
+
+	val := valueDerefAny(r.ValueOf(self.Val))
+
+	switch val.Kind() {
+	case r.Struct:
+		for _, key := range loadStructNamedLeaves(val.Type(), self.Naming) {
+			fun(key)
+		}
+
+	case r.Map:
+		if val.Type().Key().Kind() == r.String {
+			iter := val.MapRange()
+			for iter.Next() {
+				fun(iter.Key().String())
+			}
+		}
+	}
+}
+
+/*
+Returns the value of the field, method, or map key with the given name. An
+invalid output value with "true" indicates a nil value behind a nil embedded
+pointer.
+*/
+func (self PathDict) child(val r.Value, key string) (r.Value, bool) {
+	switch val.Kind() {
+	case r.Struct:
+		if self.Naming == FieldNamingGo {
+			path, ok := loadStructPathMap(val.Type())[key]
+			if !ok {
+				return r.Value{}, false
+			}
+			if path.FieldIndex != nil {
+				return valueFieldByIndex(val, path.FieldIndex), true
+			}
+
+			meth := val.Method(path.MethodIndex)
+			reqGetter(val.Type(), meth.Type(), key)
+			return meth.Call(nil)[0], true
+		}
+
+		index, ok := loadStructNamedFields(val.Type(), self.Naming)[key]
+		if !ok {
+			return r.Value{}, false
+		}
+		return valueFieldByIndex(val, index), true
+
+	case r.Map:
+		typ := val.Type().Key()
+		if typ.Kind() != r.String {
+			return r.Value{}, false
+		}
+
+		out := val.MapIndex(r.ValueOf(key).Convert(typ))
+		return out, out.IsValid()
+
+	default:
+		return r.Value{}, false
+	}
+}
+
+/*
+Implements `ArgDict` by combining several dicts, such as `List`, `Dict`, and
+`StructDict`. Lookups of both ordinal and named arguments try each dict in
+order, and the first dict which has the argument wins. Nil dicts are ignored.
+Useful for layering arguments from several sources without copying, for
+example request parameters, followed by context, followed by defaults:
+
+	StrQ{src, ArgDicts{params, ctx, LaxDict(defaults)}}
+
+Implements `OrdinalRanger` and `NamedRanger` by ranging over the union of
+arguments of those inner dicts which implement these interfaces. As a result,
+every argument of every such dict must be used, including arguments shadowed
+by earlier dicts, which are considered used when the shadowing argument is
+used. To exclude a dict from validation of unused arguments, use a type which
+doesn't implement the ranger interfaces, such as `LaxDict`.
+*/
+type ArgDicts []ArgDict
+
+// Implement part of the `ArgDict` interface.
+func (self ArgDicts) IsEmpty() bool {
+	for _, val := range self {
+		if val != nil && !val.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Implement part of the `ArgDict` interface. Returns the largest length among
+the inner dicts, which is the count of ordinal arguments available via
+`.GotOrdinal`, assuming each inner dict has contiguous ordinal arguments.
+*/
+func (self ArgDicts) Len() (out int) {
+	for _, val := range self {
+		if val != nil && val.Len() > out {
+			out = val.Len()
+		}
+	}
+	return
+}
+
+// Implement part of the `ArgDict` interface.
+func (self ArgDicts) GotOrdinal(key int) (any, bool) {
+	for _, dict := range self {
+		if dict == nil {
+			continue
+		}
+		val, ok := dict.GotOrdinal(key)
+		if ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// Implement part of the `ArgDict` interface.
+func (self ArgDicts) GotNamed(key string) (any, bool) {
+	for _, dict := range self {
+		if dict == nil {
+			continue
+		}
+		val, ok := dict.GotNamed(key)
+		if ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// Implement `pathArgDict`. True if any inner dict resolves dotted paths.
+func (self ArgDicts) resolvesPaths() bool {
+	for _, dict := range self {
+		if resolvesPaths(dict) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Implement `OrdinalRanger` to automatically validate used/unused arguments.
+Each index is visited once, even when present in several inner dicts.
+*/
+func (self ArgDicts) RangeOrdinal(fun func(int)) {
+	if fun == nil {
+		return
+	}
+
+	var found map[int]struct{}
+	for _, dict := range self {
+		impl, _ := dict.(OrdinalRanger)
+		if impl == nil {
+			continue
+		}
+
+		impl.RangeOrdinal(func(key int) {
+			if _, ok := found[key]; ok {
+				return
+			}
+			if found == nil {
+				found = map[int]struct{}{}
+			}
+			found[key] = struct{}{}
+			fun(key)
+		})
+	}
+}
+
+/*
+Implement `NamedRanger` to automatically validate used/unused arguments. Each
+name is visited once, even when present in several inner dicts.
+*/
+func (self ArgDicts) RangeNamed(fun func(string)) {
+	if fun == nil {
+		return
+	}
+
+	var found map[string]struct{}
+	for _, dict := range self {
+		impl, _ := dict.(NamedRanger)
+		if impl == nil {
+			continue
+		}
+
+		impl.RangeNamed(func(key string) {
+			if _, ok := found[key]; ok {
+				return
+			}
+			if found == nil {
+				found = map[string]struct{}{}
+			}
+			found[key] = struct{}{}
+			fun(key)
+		})
+	}
+}
+
+/*
+Wraps another `ArgDict`, enabling reuse of `Expr` arguments of repeated
+parameters in `StrQ` / `Prep`. Non-expression arguments of repeated parameters
+are always appended only once and referenced by a single ordinal parameter. By
+default, an argument implementing `Expr` is rendered at each occurrence of its
+parameter, which appends its arguments again. With this wrapper, such an
+expression is rendered only once, and its resulting text, which refers to the
+same ordinal parameters, is repeated for subsequent occurrences. Not the
+default because it assumes that expressions are deterministic and don't depend
+on their position in the query. Usage:
+
+	StrQ{src, ReuseArgs{Dict{"cond": cond}}}
+
+Applies only to the query which uses this dict directly. Forwards all lookups
+to the inner dict. Validation of unused arguments works exactly like for the
+inner dict: the ranger interfaces are forwarded when the inner dict implements
+them, and otherwise range over nothing.
+*/
+type ReuseArgs [1]ArgDict
+
+// Implement part of the `ArgDict` interface.
+func (self ReuseArgs) IsEmpty() bool { return self[0] == nil || self[0].IsEmpty() }
+
+// Implement part of the `ArgDict` interface.
+func (self ReuseArgs) Len() int {
+	if self[0] == nil {
+		return 0
+	}
+	return self[0].Len()
+}
+
+// Implement part of the `ArgDict` interface.
+func (self ReuseArgs) GotOrdinal(key int) (any, bool) {
+	if self[0] == nil {
+		return nil, false
+	}
+	return self[0].GotOrdinal(key)
+}
+
+// Implement part of the `ArgDict` interface.
+func (self ReuseArgs) GotNamed(key string) (any, bool) {
+	if self[0] == nil {
+		return nil, false
+	}
+	return self[0].GotNamed(key)
+}
+
+// Implement `OrdinalRanger`, forwarding to the inner dict if possible.
+func (self ReuseArgs) RangeOrdinal(fun func(int)) {
+	impl, _ := self[0].(OrdinalRanger)
+	if impl != nil {
+		impl.RangeOrdinal(fun)
+	}
+}
+
+// Implement `NamedRanger`, forwarding to the inner dict if possible.
+func (self ReuseArgs) RangeNamed(fun func(string)) {
+	impl, _ := self[0].(NamedRanger)
+	if impl != nil {
+		impl.RangeNamed(fun)
+	}
+}
+
+// Implement `pathArgDict`, forwarding to the inner dict.
+func (self ReuseArgs) resolvesPaths() bool { return resolvesPaths(self[0]) }
+
+func reusesExprs(val ArgDict) bool {
+	_, ok := val.(ReuseArgs)
+	return ok
+}
+
+/*
+Implemented by dictionaries which resolve dotted paths such as ":one.two"
+themselves, such as `PathDict`. For other dictionaries, a missing dotted path
+falls back on its head. See `gotNamedPath`.
+*/
+type pathArgDict interface{ resolvesPaths() bool }
+
+func resolvesPaths(val ArgDict) bool {
+	impl, _ := val.(pathArgDict)
+	return impl != nil && impl.resolvesPaths()
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	r "reflect"
+	"strings"
 )
 
 /*
@@ -228,20 +229,54 @@ func errNamed(err error) error {
 	return ErrInternal{Err{`parsing named parameter`, err}}
 }
 
-func errMissingOrdinal(val OrdinalParam) ErrMissingArgument {
+func errMissingOrdinal(val OrdinalParam, src string, pos TokenPos) ErrMissingArgument {
 	return ErrMissingArgument{Err{
 		`building SQL expression`,
-		errf(`missing ordinal argument %q (index %v)`, val, val.Index()),
+		errf(`missing ordinal argument %q (index %v)%v`, val, val.Index(), sourceExcerpt(src, pos)),
 	}}
 }
 
-func errMissingNamed(val NamedParam) ErrMissingArgument {
+func errMissingNamed(val NamedParam, src string, pos TokenPos) ErrMissingArgument {
 	return ErrMissingArgument{Err{
 		`building SQL expression`,
-		errf(`missing named argument %q (key %q)`, val, val.Key()),
+		errf(`missing named argument %q (key %q)%v`, val, val.Key(), sourceExcerpt(src, pos)),
 	}}
 }
 
+/*
+Describes the given position in the source text for error messages: the line
+and column, followed by the line itself and a caret pointing at the column.
+Tabs preceding the column are preserved in the caret line, keeping it aligned.
+Returns an empty string if the position is unknown.
+*/
+func sourceExcerpt(src string, pos TokenPos) string {
+	if !pos.IsValid() || pos.Offset > len(src) {
+		return ``
+	}
+
+	start := strings.LastIndexAny(src[:pos.Offset], "\n\r") + 1
+	end := len(src)
+	if ind := strings.IndexAny(src[pos.Offset:], "\n\r"); ind >= 0 {
+		end = pos.Offset + ind
+	}
+
+	var buf strings.Builder
+	buf.WriteString(` at `)
+	buf.WriteString(pos.String())
+	buf.WriteString(":\n\t")
+	buf.WriteString(src[start:end])
+	buf.WriteString("\n\t")
+	for _, char := range src[start:pos.Offset] {
+		if char == '\t' {
+			buf.WriteByte('\t')
+		} else {
+			buf.WriteByte(' ')
+		}
+	}
+	buf.WriteByte('^')
+	return buf.String()
+}
+
 func errUnusedOrdinal(val OrdinalParam) ErrUnusedArgument {
 	return ErrUnusedArgument{Err{
 		`building SQL expression`,
@@ -256,6 +291,27 @@ func errUnusedNamed(val NamedParam) ErrUnusedArgument {
 	}}
 }
 
+func errTemplateOrdinal(val OrdinalParam, typ r.Type, src string, pos TokenPos) ErrUnexpectedParameter {
+	return ErrUnexpectedParameter{Err{
+		`preparing template for ` + typeName(typ),
+		errf(`unsupported ordinal parameter %q; templates support only named parameters%v`, val, sourceExcerpt(src, pos)),
+	}}
+}
+
+func errTemplateMissingField(val NamedParam, typ r.Type, src string, pos TokenPos) ErrMissingArgument {
+	return ErrMissingArgument{Err{
+		`preparing template for ` + typeName(typ),
+		errf(`named parameter %q has no corresponding field%v`, val, sourceExcerpt(src, pos)),
+	}}
+}
+
+func errTemplateUnusedField(name string, typ r.Type) ErrUnusedArgument {
+	return ErrUnusedArgument{Err{
+		`preparing template for ` + typeName(typ),
+		errf(`field %q is not used by any named parameter`, name),
+	}}
+}
+
 func errExpectedX(desc, while string, val any) ErrInvalidInput {
 	return ErrInvalidInput{Err{
 		while,
@@ -308,3 +364,13 @@ func errInvalidOrd(src string) ErrInvalidInput {
 		),
 	}}
 }
+
+func errInvalidOrdText(src string) ErrInvalidInput {
+	return ErrInvalidInput{Err{
+		`parsing ordering expression`,
+		errf(
+			`%q is not a valid ordering string; expected "<ident> (asc|desc)? (nulls (?:first|last))?", optionally with a leading "-" or "+" or trailing modifiers ".asc", ".desc", ".nullsfirst", ".nullslast"`,
+			src,
+		),
+	}}
+}
@@ -5,6 +5,7 @@ import (
 	r "reflect"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 /*
@@ -914,6 +915,74 @@ func (self StructsInsert[_]) AppendTo(text []byte) []byte { return exprAppend(se
 // Implement the `fmt.Stringer` interface for debug purposes.
 func (self StructsInsert[_]) String() string { return exprString(self) }
 
+/*
+Splits the rows into consecutive batches, preserving their order, such that
+each batch generates at most the given count of parameters. Each batch is a
+`StructsInsert` with the same column layout, suitable for a separate "insert"
+statement. Useful for staying within the limits of database drivers, such as
+`PostgresParamLimit`. If the enclosing query has other parameters, subtract
+their count from the limit. A non-positive limit means no limit, returning a
+single batch. An empty slice returns no batches. Panics if a single row
+exceeds the limit.
+*/
+func (self StructsInsert[A]) Batches(limit int) []StructsInsert[A] {
+	var out []StructsInsert[A]
+	for _, val := range batchByParams(self, limit, structValuesOf[A]) {
+		out = append(out, val)
+	}
+	return out
+}
+
+func structValuesOf[A any](val A) Expr { return StructValues{val} }
+
+/*
+Maximum count of parameters in a single Postgres statement. See
+`(StructsInsert).Batches`.
+*/
+const PostgresParamLimit = 65535
+
+/*
+Splits rows into batches whose expressions, generated by the given function,
+have at most the given total count of arguments. The count for each row is
+determined by rendering its expression, since expressions nested in fields may
+generate any count of arguments.
+*/
+func batchByParams[A any](rows []A, limit int, expr func(A) Expr) (out [][]A) {
+	if len(rows) <= 0 {
+		return nil
+	}
+	if limit <= 0 {
+		return [][]A{rows}
+	}
+
+	var text []byte
+	var args []any
+	start := 0
+	count := 0
+
+	for ind, row := range rows {
+		text, args = expr(row).AppendExpr(text[:0], args[:0])
+		size := len(args)
+
+		if size > limit {
+			panic(errExpectedX(
+				fmt.Sprintf(`row with at most %v parameters`, limit),
+				`splitting rows into batches`,
+				fmt.Sprintf(`row %v with %v parameters`, ind, size),
+			))
+		}
+
+		if count+size > limit {
+			out = append(out, rows[start:ind:ind])
+			start = ind
+			count = 0
+		}
+		count += size
+	}
+
+	return append(out, rows[start:])
+}
+
 /*
 Represents an SQL assignment clause suitable for "update set" operations. The
 inner value must be a struct. The resulting expression consists of
@@ -1569,6 +1638,15 @@ func (self StrQ) AppendTo(text []byte) []byte { return exprAppend(self, text) }
 // Implement the `fmt.Stringer` interface for debug purposes.
 func (self StrQ) String() string { return exprString(self) }
 
+/*
+Renders the query like `Reify`, additionally returning how each parameter was
+bound. See `ParamBinding`.
+*/
+func (self StrQ) ReifyBindings() (string, []any, []ParamBinding) {
+	text, args, binds := Preparse(self.Text).AppendParamExprBindings(nil, nil, self.Args)
+	return bytesToMutableString(text), args, binds
+}
+
 /*
 Short for "preparsed" or "prepared". Partially parsed representation of
 parametrized SQL expressions, suited for efficiently building SQL queries by
@@ -1591,17 +1669,25 @@ func (self *Prep) Parse() {
 	for each source string to avoid redundant parsing.
 	*/
 
-	src := strings.TrimSpace(self.Source)
-	tok := Tokenizer{Source: src, Transform: trimWhitespaceAndComments}
+	/**
+	Equivalent to tokenizing `strings.TrimSpace(self.Source)`, but keeps token
+	positions relative to the original source, which allows errors to point at
+	the right place.
+	*/
+	src := self.Source
+	end := len(strings.TrimRightFunc(src, unicode.IsSpace))
+	start := end - len(strings.TrimLeftFunc(src[:end], unicode.IsSpace))
+	tok := Tokenizer{Source: src[:end], Transform: trimWhitespaceAndComments, cursor: start}
 
 	// Suboptimal, could be avoided.
 	buf := make([]byte, 0, 128)
+	var pos TokenPos
 
 	flush := func() {
 		if len(buf) > 0 {
 			// Suboptimal. It would be better to reslice the source string instead of
 			// allocating new strings.
-			self.Tokens = append(self.Tokens, Token{string(buf), TokenTypeText})
+			self.Tokens = append(self.Tokens, Token{string(buf), TokenTypeText, pos})
 		}
 		buf = buf[:0]
 	}
@@ -1619,6 +1705,9 @@ func (self *Prep) Parse() {
 			self.HasParams = true
 
 		default:
+			if len(buf) <= 0 {
+				pos = tok.Pos
+			}
 			buf = append(buf, tok.Text...)
 		}
 	}
@@ -1644,6 +1733,48 @@ func (self Prep) AppendTo(text []byte) []byte {
 // Implement the `fmt.Stringer` interface for debug purposes.
 func (self Prep) String() string { return self.Source }
 
+/*
+Variant of `.AppendParamExpr` which also reports how each parameter in the
+source was bound. See `ParamBinding`. The bindings are listed in the order of
+the first occurrence of each parameter, and each parameter is listed once.
+*/
+func (self Prep) AppendParamExprBindings(text []byte, args []any, dict ArgDict) ([]byte, []any, []ParamBinding) {
+	if !self.HasParams {
+		text, args = self.appendUnparametrized(text, args, dict)
+		return text, args, nil
+	}
+
+	tracker := getArgTracker()
+	defer tracker.put()
+	tracker.RecordBindings = true
+
+	text, args = self.appendTracked(text, args, dict, tracker)
+	return text, args, tracker.Bindings
+}
+
+/*
+Describes how a parameter in the source of a `Prep` or `StrQ`, such as
+":user_id" or "$1", was bound to an argument. `.Ordinal` is the ordinal
+parameter in the resulting query, such as "$3", which refers to `.Value`. When
+the value implements `Expr`, it's rendered as a sub-expression rather than as
+an argument, and `.Ordinal` is zero. Useful for logging arguments by name. See
+`(StrQ).ReifyBindings` and `(Prep).AppendParamExprBindings`.
+*/
+type ParamBinding struct {
+	Param   string
+	Ordinal OrdinalParam
+	Value   any
+}
+
+// Implement `fmt.Stringer` for debug purposes, using the format ":name -> $1".
+func (self ParamBinding) String() string {
+	impl, _ := self.Value.(Expr)
+	if self.Ordinal <= 0 && impl != nil {
+		return self.Param + ` -> ` + exprString(impl)
+	}
+	return self.Param + ` -> ` + self.Ordinal.String()
+}
+
 func (self Prep) appendUnparametrized(text []byte, args []any, dict ArgDict) ([]byte, []any) {
 	src := self.Source
 	if !isNil(dict) {
@@ -1653,24 +1784,28 @@ func (self Prep) appendUnparametrized(text []byte, args []any, dict ArgDict) ([]
 }
 
 func (self Prep) appendParametrized(text []byte, args []any, dict ArgDict) ([]byte, []any) {
+	tracker := getArgTracker()
+	defer tracker.put()
+	return self.appendTracked(text, args, dict, tracker)
+}
+
+func (self Prep) appendTracked(text []byte, args []any, dict ArgDict, tracker *argTracker) ([]byte, []any) {
 	if dict == nil {
 		panic(errMissingArgs(fmt.Sprintf(`parametrized expression %q`, self.Source)))
 	}
 
 	bui := Bui{text, args}
 	bui.Grow(len(self.Source), dict.Len())
-
-	tracker := getArgTracker()
-	defer tracker.put()
+	tracker.ReuseExprs = reusesExprs(dict)
 
 	for _, tok := range self.Tokens {
 		switch tok.Type {
 		case TokenTypeOrdinalParam:
 			// Parsing the token here is slightly suboptimal, we should preparse numbers.
-			appendOrdinal(&bui, dict, tracker, tok.ParseOrdinalParam())
+			appendOrdinal(&bui, dict, tracker, tok.ParseOrdinalParam(), self.Source, tok.Pos)
 
 		case TokenTypeNamedParam:
-			appendNamed(&bui, dict, tracker, tok.ParseNamedParam())
+			appendNamed(&bui, dict, tracker, tok.ParseNamedParam(), self.Source, tok.Pos)
 
 		default:
 			bui.Text = append(bui.Text, tok.Text...)
@@ -1697,17 +1832,30 @@ potentially much larger, for example when an argument is a huge array.
 Keeping track of found PARAMETERS also allows us to validate that all ARGUMENTS
 are used.
 */
-func appendOrdinal(bui *Bui, args ArgDict, tracker *argTracker, key OrdinalParam) {
+func appendOrdinal(bui *Bui, args ArgDict, tracker *argTracker, key OrdinalParam, src string, pos TokenPos) {
 	arg, ok := args.GotOrdinal(key.Index())
 	if !ok {
-		panic(errMissingOrdinal(key))
+		panic(errMissingOrdinal(key, src, pos))
 	}
 
 	impl, _ := arg.(Expr)
 	if impl != nil {
+		if tracker.ReuseExprs {
+			text, ok := tracker.OrdinalExprs[key]
+			if ok {
+				bui.Space()
+				bui.Text = append(bui.Text, text...)
+				return
+			}
+		}
+
 		// Allows validation of used args.
 		tracker.SetOrdinal(key, 0)
-		bui.Expr(impl)
+		tracker.SetBinding(ParamBinding{key.String(), 0, arg})
+		start := appendExprArg(bui, impl)
+		if tracker.ReuseExprs {
+			tracker.SetOrdinalExpr(key, string(bui.Text[start:]))
+		}
 		return
 	}
 
@@ -1720,19 +1868,72 @@ func appendOrdinal(bui *Bui, args ArgDict, tracker *argTracker, key OrdinalParam
 	ord = bui.OrphanArg(arg)
 	bui.OrphanParam(ord)
 	tracker.SetOrdinal(key, ord)
+	tracker.SetBinding(ParamBinding{key.String(), ord, arg})
+}
+
+func appendNamed(bui *Bui, args ArgDict, tracker *argTracker, key NamedParam, src string, pos TokenPos) {
+	arg, key, rest, ok := gotNamedPath(args, tracker, key)
+	if !ok {
+		panic(errMissingNamed(key, src, pos))
+	}
+	appendNamedArg(bui, tracker, key, arg)
+	bui.Text = append(bui.Text, rest...)
 }
 
-func appendNamed(bui *Bui, args ArgDict, tracker *argTracker, key NamedParam) {
+/*
+Finds the argument for a named parameter. Dotted paths such as ":one.two" are
+resolved only by dictionaries which opt in, such as `PathDict`, and for them,
+the head of a resolved path is considered used when validating unused
+arguments. For other dictionaries, when the full path is missing, this falls
+back on the head of the path, such as ":alias" for ":alias.col", returning the
+rest of the path, such as ".col", to be appended as text. This preserves the
+behavior of queries written before dotted paths were supported.
+*/
+func gotNamedPath(args ArgDict, tracker *argTracker, key NamedParam) (any, NamedParam, string, bool) {
 	arg, ok := args.GotNamed(key.Key())
+	head, rest := key.SplitPath()
+
+	if rest == `` {
+		return arg, key, ``, ok
+	}
+
+	if resolvesPaths(args) {
+		if ok && tracker != nil {
+			tracker.SetPath(head)
+		}
+		return arg, key, ``, ok
+	}
+
+	if ok {
+		return arg, key, ``, true
+	}
+
+	arg, ok = args.GotNamed(head.Key())
 	if !ok {
-		panic(errMissingNamed(key))
+		return nil, key, ``, false
 	}
+	return arg, head, rest, true
+}
 
+func appendNamedArg(bui *Bui, tracker *argTracker, key NamedParam, arg any) {
 	impl, _ := arg.(Expr)
 	if impl != nil {
+		if tracker.ReuseExprs {
+			text, ok := tracker.NamedExprs[key]
+			if ok {
+				bui.Space()
+				bui.Text = append(bui.Text, text...)
+				return
+			}
+		}
+
 		// Allows validation of used args.
 		tracker.SetNamed(key, 0)
-		bui.Expr(impl)
+		tracker.SetBinding(ParamBinding{key.String(), 0, arg})
+		start := appendExprArg(bui, impl)
+		if tracker.ReuseExprs {
+			tracker.SetNamedExpr(key, string(bui.Text[start:]))
+		}
 		return
 	}
 
@@ -1745,6 +1946,18 @@ func appendNamed(bui *Bui, args ArgDict, tracker *argTracker, key NamedParam) {
 	ord = bui.OrphanArg(arg)
 	bui.OrphanParam(ord)
 	tracker.SetNamed(key, ord)
+	tracker.SetBinding(ParamBinding{key.String(), ord, arg})
+}
+
+/*
+Equivalent to `(*Bui).Expr`, but returns the offset of the text appended by the
+expression, allowing to repeat it for `ReuseArgs`.
+*/
+func appendExprArg(bui *Bui, val Expr) int {
+	bui.Space()
+	start := len(bui.Text)
+	bui.Set(val.AppendExpr(bui.Get()))
+	return start
 }
 
 // Represents an ordinal parameter such as "$1". Mostly for internal use.
@@ -1795,6 +2008,19 @@ func (self NamedParam) String() string { return AppenderString(&self) }
 // is a free cast, used to increase code clarity.
 func (self NamedParam) Key() string { return string(self) }
 
+/*
+Splits a dotted path such as ":one.two.three" into the head parameter ":one"
+and the rest of the path ".two.three", including the leading dot. For
+parameters without dots, the rest is empty.
+*/
+func (self NamedParam) SplitPath() (NamedParam, string) {
+	ind := strings.IndexByte(string(self), '.')
+	if ind >= 0 {
+		return self[:ind], string(self[ind:])
+	}
+	return self, ``
+}
+
 /*
 Represents SQL expression "limit N" with an arbitrary argument or
 sub-expression. Implements `Expr`:
@@ -0,0 +1,273 @@
+package sqlb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+/*
+Stable fingerprint of a query's shape, suitable for tagging database metrics.
+Queries that differ only in literal values, parameters, the number of elements
+in "in" lists, the number of rows in "values", whitespace, comments, or the
+case of unquoted words, produce the same fingerprint. `.Text` is the normalized
+query text, and `.Hash` is its 64-bit FNV-1a hash. See `FingerprintOf` and
+`FingerprintText`.
+*/
+type Fingerprint struct {
+	Text string
+	Hash uint64
+}
+
+// Implement `fmt.Stringer`. Returns the hash as 16 hexadecimal digits.
+func (self Fingerprint) String() string { return fmt.Sprintf(`%016x`, self.Hash) }
+
+/*
+Shortcut for fingerprinting an arbitrary expression. Reifies the expression and
+calls `FingerprintText` on the resulting text, ignoring the arguments.
+*/
+func FingerprintOf(val Expr) Fingerprint {
+	text, _ := Reify(val)
+	return FingerprintText(text)
+}
+
+/*
+Computes the fingerprint of the given SQL text, normalizing it via `Tokenizer`:
+
+	* Whitespace and comments are normalized; spacing around punctuation is
+	  made consistent.
+	* Unquoted words are lowercased. Quoted identifiers are preserved.
+	* String literals, numbers, and ordinal or named parameters are replaced
+	  with "?". A unary minus before a number, such as in "= -1", is part of
+	  the number.
+	* Lists of literals or parameters following "in", such as "in ($1, $2)",
+	  are collapsed into "in(?)".
+	* Identical consecutive parenthesized groups, such as rows in a multi-row
+	  "values" clause, are collapsed into one.
+	* Trailing semicolons are removed.
+
+Panics if the text is malformed, for example if it has an unclosed quoted
+string.
+*/
+func FingerprintText(src string) Fingerprint {
+	var state fingerprinter
+	state.format(src)
+	text := strings.TrimRight(string(state.buf), `; `)
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(text))
+	return Fingerprint{text, hash.Sum64()}
+}
+
+type fingerprinter struct {
+	buf    []byte
+	prev   string
+	groups []fingerprintGroup
+	lasts  []fingerprintSpan
+	minus  fingerprintMinus
+}
+
+type fingerprintGroup struct {
+	start   int
+	afterIn bool
+}
+
+type fingerprintSpan struct{ start, end int }
+
+/*
+Unary minus written immediately before, which is removed if followed by a
+number. `.prev` is the lexeme preceding the minus.
+*/
+type fingerprintMinus struct {
+	ok    bool
+	start int
+	prev  string
+}
+
+func (self *fingerprinter) format(src string) {
+	tok := Tokenizer{Source: src}
+
+	for {
+		val := tok.Next()
+
+		switch val.Type {
+		case TokenTypeInvalid:
+			return
+
+		case TokenTypeWhitespace, TokenTypeCommentLine, TokenTypeCommentBlock:
+
+		case TokenTypeText:
+			text := val.Text
+			for len(text) > 0 {
+				head := headFingerprintLexeme(text)
+				text = text[len(head):]
+				self.lexeme(head)
+			}
+
+		case TokenTypeQuotedSingle, TokenTypeQuotedEscape, TokenTypeQuotedDollar,
+			TokenTypeOrdinalParam, TokenTypeNamedParam:
+			self.write(`?`)
+
+		default:
+			self.write(val.Text)
+		}
+	}
+}
+
+func (self *fingerprinter) lexeme(val string) {
+	head := val[0]
+
+	switch {
+	case charsetDigitDec.has(head):
+		if self.minus.ok {
+			self.buf, self.prev = self.buf[:self.minus.start], self.minus.prev
+		}
+		self.write(`?`)
+
+	case val == `-` && isFingerprintOperandStart(self.prev):
+		minus := fingerprintMinus{true, len(self.buf), self.prev}
+		self.write(val)
+		self.minus = minus
+
+	case isScriptWordStart(head):
+		self.write(strings.ToLower(val))
+
+	case head == '(':
+		afterIn := self.prev == `in`
+		self.write(val)
+		self.groups = append(self.groups, fingerprintGroup{len(self.buf) - len(val), afterIn})
+
+	case head == ')':
+		self.write(val)
+		self.closeGroup()
+
+	default:
+		self.write(val)
+	}
+}
+
+func (self *fingerprinter) write(val string) {
+	self.minus.ok = false
+	if len(self.buf) > 0 && self.spaceBefore(val) {
+		self.buf = append(self.buf, ' ')
+	}
+	self.buf = append(self.buf, val...)
+	self.prev = val
+}
+
+/*
+Spacing is independent of the source text. Parentheses are attached to the
+preceding word or operator, which makes "count(*)" and "count (*)", or
+"in(?)" and "in (?)", equivalent.
+*/
+func (self *fingerprinter) spaceBefore(val string) bool {
+	switch self.prev {
+	case `(`, `[`, `.`, `::`:
+		return false
+	}
+
+	switch val {
+	case `(`, `[`:
+		return self.prev == `,`
+	case `)`, `]`, `,`, `.`, `::`, `;`:
+		return false
+	}
+	return true
+}
+
+func (self *fingerprinter) closeGroup() {
+	if len(self.groups) <= 0 {
+		return
+	}
+
+	group := self.groups[len(self.groups)-1]
+	self.groups = self.groups[:len(self.groups)-1]
+	depth := len(self.groups)
+
+	if group.afterIn && isFingerprintValueList(string(self.buf[group.start:])) {
+		self.buf = append(self.buf[:group.start], `(?)`...)
+	}
+
+	for len(self.lasts) <= depth {
+		self.lasts = append(self.lasts, fingerprintSpan{-1, -1})
+	}
+	self.lasts = self.lasts[:depth+1]
+
+	last := self.lasts[depth]
+	if last.end >= 0 && last.end <= group.start &&
+		string(self.buf[last.end:group.start]) == `, ` &&
+		string(self.buf[last.start:last.end]) == string(self.buf[group.start:]) {
+		self.buf = self.buf[:last.end]
+		return
+	}
+
+	self.lasts[depth] = fingerprintSpan{group.start, len(self.buf)}
+}
+
+/*
+Similar to `headScriptLexeme`, but treats numbers and runs of operator
+characters as single lexemes.
+*/
+func headFingerprintLexeme(src string) string {
+	head := src[0]
+
+	if charsetDigitDec.has(head) {
+		ind := 1
+		for ind < len(src) && (charsetIdent.has(src[ind]) || src[ind] == '.') {
+			ind++
+		}
+		return src[:ind]
+	}
+
+	if charsetFingerprintOperator.has(head) {
+		ind := 1
+		for ind < len(src) && charsetFingerprintOperator.has(src[ind]) && !isFingerprintMinusNumber(src[ind:]) {
+			ind++
+		}
+		return src[:ind]
+	}
+
+	return headScriptLexeme(src)
+}
+
+// True for text such as "-1", allowing to split "=-1" into "=" and "-1".
+func isFingerprintMinusNumber(src string) bool {
+	return len(src) >= 2 && src[0] == '-' && charsetDigitDec.has(src[1])
+}
+
+/*
+True if the next lexeme is in operand position, which is where a minus is
+unary: at the start, after an opening bracket, a comma, an operator, or a
+keyword which precedes an expression. The placeholder "?" is an operand.
+*/
+func isFingerprintOperandStart(prev string) bool {
+	if prev == `?` {
+		return false
+	}
+	if prev == `` || charsetFingerprintOperator.has(prev[0]) {
+		return true
+	}
+
+	switch prev {
+	case `(`, `[`, `,`,
+		`select`, `where`, `and`, `or`, `not`, `when`, `then`, `else`, `in`,
+		`is`, `like`, `ilike`, `between`, `by`, `limit`, `offset`, `having`,
+		`on`, `set`, `return`, `returning`, `values`, `distinct`, `all`, `any`:
+		return true
+	}
+	return false
+}
+
+var charsetFingerprintOperator = new(charset).addStr(`+-*/<>=~!@#%^&|?`)
+
+// True for text such as "(?)" or "(?, ?, ?)".
+func isFingerprintValueList(val string) bool {
+	val = strings.TrimPrefix(val, `(`)
+	val = strings.TrimSuffix(val, `)`)
+	for _, elem := range strings.Split(val, `, `) {
+		if elem != `?` {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package sqlb
+
+/*
+Shortcut for `Formatter{}.Format(src)`. Collapses whitespace and strips
+comments, producing single-line SQL suitable for logs. See `Formatter`.
+*/
+func Minify(src string) string { return Formatter{}.Format(src) }
+
+/*
+Shortcut for `Formatter{Pretty: true}.Format(src)`. Places major clauses on
+separate lines and indents subqueries. See `Formatter`.
+*/
+func Prettify(src string) string { return Formatter{Pretty: true}.Format(src) }
+
+/*
+SQL formatter built on `Tokenizer`. Normalizes whitespace and strips comments,
+without touching the content of quoted strings, quoted identifiers,
+dollar-quoted strings, or parameters. Intended for the output of `Reify` or
+`(*Bui).Reify`, whose text often carries the indentation and comments of
+`StrQ` templates. Panics if the text is malformed, for example if it has an
+unclosed quoted string.
+
+Minification (default) replaces every sequence of whitespace and comments with
+a single space, and trims the text. The result is semantically equivalent to
+the original.
+
+Pretty-printing, enabled via `.Pretty`, additionally places major clauses such
+as "select", "from", "where", "order by", and joins on separate lines, and
+indents subqueries in parentheses. Join conditions, boolean operators, and
+clauses inside other parentheses, such as "order by" in "over (...)", are left
+inline. `.Indent` is used for each level of indentation, and defaults to a tab.
+*/
+type Formatter struct {
+	Pretty bool
+	Indent string
+}
+
+// Formats the given SQL text. See `Formatter`.
+func (self Formatter) Format(src string) string {
+	return bytesToMutableString(self.Append(nil, src))
+}
+
+// Formats the given SQL text, appending the result to the given buffer.
+func (self Formatter) Append(buf []byte, src string) []byte {
+	state := sqlFormatter{Formatter: self, buf: buf, start: len(buf)}
+	state.format(src)
+	return state.buf
+}
+
+type sqlFormatter struct {
+	Formatter
+	buf    []byte
+	start  int
+	tok    Tokenizer
+	space  bool
+	prev   string
+	parens []bool
+}
+
+func (self *sqlFormatter) format(src string) {
+	self.tok = Tokenizer{Source: src}
+
+	for {
+		tok := self.tok.Next()
+
+		switch tok.Type {
+		case TokenTypeInvalid:
+			return
+
+		case TokenTypeWhitespace, TokenTypeCommentLine, TokenTypeCommentBlock:
+			self.space = true
+
+		case TokenTypeText:
+			text := tok.Text
+			for len(text) > 0 {
+				val := headScriptLexeme(text)
+				text = text[len(val):]
+				self.lexeme(val, text)
+			}
+
+		default:
+			self.write(tok.Text)
+		}
+	}
+}
+
+/*
+Handles a single word or punctuation character from a text token. "rest" is the
+remainder of the text token, used for lookahead.
+*/
+func (self *sqlFormatter) lexeme(val, rest string) {
+	if !self.Pretty {
+		self.write(val)
+		return
+	}
+
+	switch {
+	case val == `(`:
+		self.write(val)
+		self.parens = append(self.parens, false)
+
+	case val == `)`:
+		if self.popParen() {
+			self.newline()
+		}
+		self.write(val)
+
+	case self.prev == `(` && isFormatSubqueryStart(val):
+		self.parens[len(self.parens)-1] = true
+		self.newline()
+		self.write(val)
+
+	case self.isClauseStart(val, rest):
+		if len(self.buf) > self.start {
+			self.newline()
+		}
+		self.write(val)
+
+	default:
+		self.write(val)
+	}
+}
+
+func (self *sqlFormatter) isClauseStart(val, rest string) bool {
+	if isFormatClauseModifier(self.prev) {
+		return false
+	}
+	if len(self.parens) > 0 && !self.parens[len(self.parens)-1] {
+		return false
+	}
+
+	// Unlike join conditions, "on conflict" is a clause.
+	if equalFoldAny(val, `on`) {
+		return equalFoldAny(peekLexeme(rest, self.tok), `conflict`)
+	}
+
+	// Functions such as "left(...)" and "right(...)".
+	if isFormatJoinModifier(val) {
+		return peekLexeme(rest, self.tok) != `(`
+	}
+	return isFormatClause(val)
+}
+
+func (self *sqlFormatter) write(val string) {
+	if self.space && len(self.buf) > self.start && !self.atLineStart() {
+		self.buf = append(self.buf, ' ')
+	}
+	self.space = false
+	self.buf = append(self.buf, val...)
+	self.prev = val
+}
+
+func (self *sqlFormatter) newline() {
+	self.space = false
+	if self.atLineStart() {
+		return
+	}
+
+	self.buf = append(self.buf, '\n')
+	for ind := self.depth(); ind > 0; ind-- {
+		self.buf = append(self.buf, self.indent()...)
+	}
+}
+
+// True if the buffer ends with a newline, possibly followed by indentation.
+func (self *sqlFormatter) atLineStart() bool {
+	for ind := len(self.buf) - 1; ind >= self.start; ind-- {
+		switch self.buf[ind] {
+		case '\n':
+			return true
+		case ' ', '\t':
+			continue
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// Returns true if the closed parenthesis contained a subquery.
+func (self *sqlFormatter) popParen() bool {
+	if len(self.parens) <= 0 {
+		return false
+	}
+	out := self.parens[len(self.parens)-1]
+	self.parens = self.parens[:len(self.parens)-1]
+	return out
+}
+
+// Current level of indentation: the count of enclosing subqueries.
+func (self *sqlFormatter) depth() (out int) {
+	for _, val := range self.parens {
+		if val {
+			out++
+		}
+	}
+	return
+}
+
+func (self *sqlFormatter) indent() string {
+	if self.Indent != `` {
+		return self.Indent
+	}
+	return "\t"
+}
+
+func isFormatSubqueryStart(val string) bool {
+	return equalFoldAny(val, `select`, `with`, `values`)
+}
+
+func isFormatClause(val string) bool {
+	return equalFoldAny(
+		val,
+		`select`, `from`, `where`, `group`, `having`, `window`, `order`, `limit`,
+		`offset`, `fetch`, `union`, `intersect`, `except`, `insert`, `values`,
+		`update`, `set`, `delete`, `returning`, `join`, `inner`, `left`, `right`,
+		`full`, `cross`, `natural`,
+	)
+}
+
+// Words after which clause keywords continue the current line.
+func isFormatClauseModifier(val string) bool {
+	return isFormatJoinModifier(val) || equalFoldAny(
+		val, `inner`, `full`, `cross`, `natural`, `outer`, `delete`, `do`, `for`,
+		`key`, `share`, `within`, `distinct`,
+	)
+}
+
+func isFormatJoinModifier(val string) bool {
+	return equalFoldAny(val, `left`, `right`)
+}
@@ -143,6 +143,8 @@ The result is roughly equivalent to the following (formatted for clarity):
 		("field_two")."field_three" < '9999-01-01T00:00:00Z'
 	`
 	args := []any{"literal string", time.Time("9999-01-01T00:00:00Z")}
+
+Fields can be hidden from clients via `JelFiltered`.
 */
 type Jel struct {
 	Type r.Type
@@ -157,15 +159,7 @@ with "github.com/mitranim/sqlb". Always generates a valid boolean expression,
 falling back on "true" if empty.
 */
 func (self Jel) AppendExpr(text []byte, args []any) ([]byte, []any) {
-	bui := Bui{text, args}
-
-	if len(self.Text) <= 0 {
-		bui.Str(`true`)
-	} else {
-		self.decode(&bui, stringToBytesUnsafe(self.Text))
-	}
-
-	return bui.Get()
+	return JelFiltered{Jel: self}.AppendExpr(text, args)
 }
 
 // Implement the `AppenderTo` interface, sometimes allowing more efficient text
@@ -205,7 +199,59 @@ func (self *Jel) OrType(typ any) {
 	}
 }
 
-func (self *Jel) decode(bui *Bui, input []byte) {
+/*
+Variant of `Jel` with field-level access control, similar to `ParseOpt` for
+ords parsing. Fields can be hidden from clients via `.Filter`, for example
+`TagFilter`. Like fields missing from the struct, hidden fields cause
+transcoding to fail with `ErrUnknownField`, unless `.Lax` is set. All methods
+of `Jel` are available and respect these options. Usage:
+
+	expr := JelFiltered{Jel: Jel{typ, src}, Filter: TagFilter(`jel`)}
+*/
+type JelFiltered struct {
+	Jel
+
+	/**
+	Optional filter. When non-nil, this is invoked for each struct field
+	referenced by the expression, either as an identifier or as a cast. If this
+	returns false, the field is "unknown" and may generate an error depending on
+	`.Lax`.
+	*/
+	Filter Filter
+
+	/**
+	When true, unknown field paths don't cause errors. Instead, each reference
+	to an unknown field, and each cast into an unknown field, is replaced with
+	SQL null. This usually makes the corresponding condition null, excluding
+	all rows. When false, unknown field paths cause transcoding to fail with a
+	descriptive error.
+	*/
+	Lax bool
+}
+
+var _ = Expr(JelFiltered{})
+
+// Implement `Expr`. See `Jel.AppendExpr` for docs.
+func (self JelFiltered) AppendExpr(text []byte, args []any) ([]byte, []any) {
+	bui := Bui{text, args}
+
+	if len(self.Text) <= 0 {
+		bui.Str(`true`)
+	} else {
+		self.decode(&bui, stringToBytesUnsafe(self.Text))
+	}
+
+	return bui.Get()
+}
+
+// Implement the `AppenderTo` interface, sometimes allowing more efficient text
+// encoding.
+func (self JelFiltered) AppendTo(text []byte) []byte { return exprAppend(&self, text) }
+
+// Implement the `fmt.Stringer` interface for debug purposes.
+func (self JelFiltered) String() string { return exprString(&self) }
+
+func (self *JelFiltered) decode(bui *Bui, input []byte) {
 	input = bytes.TrimSpace(input)
 
 	if isJsonDict(input) {
@@ -222,39 +268,8 @@ func (self *Jel) decode(bui *Bui, input []byte) {
 	}
 }
 
-func (self *Jel) decodeList(bui *Bui, input []byte) {
-	var list []json.RawMessage
-	err := json.Unmarshal(input, &list)
-	if err != nil {
-		panic(ErrInvalidInput{Err{
-			`decoding JEL list`,
-			fmt.Errorf(`failed to unmarshal as JSON list: %w`, err),
-		}})
-	}
-
-	if !(len(list) > 0) {
-		panic(ErrInvalidInput{Err{
-			`decoding JEL list`,
-			ErrStr(`lists must have at least one element, found empty list`),
-		}})
-	}
-
-	head, args := list[0], list[1:]
-	if !isJsonString(head) {
-		panic(ErrInvalidInput{Err{
-			`decoding JEL list`,
-			errf(`first list element must be a string, found %q`, head),
-		}})
-	}
-
-	var name string
-	err = json.Unmarshal(head, &name)
-	if err != nil {
-		panic(ErrInvalidInput{Err{
-			`decoding JEL list`,
-			fmt.Errorf(`failed to unmarshal JSON list head as string: %w`, err),
-		}})
-	}
+func (self *JelFiltered) decodeList(bui *Bui, input []byte) {
+	name, args := jelListHead(`decoding JEL list`, input)
 
 	switch Ops[name] {
 	case OpPrefix:
@@ -274,7 +289,7 @@ func (self *Jel) decodeList(bui *Bui, input []byte) {
 	}
 }
 
-func (self *Jel) decodeOpPrefix(bui *Bui, name string, args []json.RawMessage) {
+func (self *JelFiltered) decodeOpPrefix(bui *Bui, name string, args []json.RawMessage) {
 	if len(args) != 1 {
 		panic(ErrInvalidInput{Err{
 			`decoding JEL op (prefix)`,
@@ -288,7 +303,7 @@ func (self *Jel) decodeOpPrefix(bui *Bui, name string, args []json.RawMessage) {
 	bui.Str(`)`)
 }
 
-func (self *Jel) decodeOpPostfix(bui *Bui, name string, args []json.RawMessage) {
+func (self *JelFiltered) decodeOpPostfix(bui *Bui, name string, args []json.RawMessage) {
 	if len(args) != 1 {
 		panic(ErrInvalidInput{Err{
 			`decoding JEL op (postfix)`,
@@ -302,7 +317,7 @@ func (self *Jel) decodeOpPostfix(bui *Bui, name string, args []json.RawMessage)
 	bui.Str(`)`)
 }
 
-func (self *Jel) decodeOpInfix(bui *Bui, name string, args []json.RawMessage) {
+func (self *JelFiltered) decodeOpInfix(bui *Bui, name string, args []json.RawMessage) {
 	if !(len(args) >= 2) {
 		panic(ErrInvalidInput{Err{
 			`decoding JEL op (infix)`,
@@ -320,7 +335,7 @@ func (self *Jel) decodeOpInfix(bui *Bui, name string, args []json.RawMessage) {
 	bui.Str(`)`)
 }
 
-func (self *Jel) decodeOpFunc(bui *Bui, name string, args []json.RawMessage) {
+func (self *JelFiltered) decodeOpFunc(bui *Bui, name string, args []json.RawMessage) {
 	bui.Str(name)
 	bui.Str(`(`)
 	for ind, arg := range args {
@@ -332,7 +347,7 @@ func (self *Jel) decodeOpFunc(bui *Bui, name string, args []json.RawMessage) {
 	bui.Str(`)`)
 }
 
-func (self *Jel) decodeOpAny(bui *Bui, name string, args []json.RawMessage) {
+func (self *JelFiltered) decodeOpAny(bui *Bui, name string, args []json.RawMessage) {
 	if len(args) != 2 {
 		panic(ErrInvalidInput{Err{
 			`decoding JEL op`,
@@ -350,7 +365,7 @@ func (self *Jel) decodeOpAny(bui *Bui, name string, args []json.RawMessage) {
 	bui.Str(`)`)
 }
 
-func (self *Jel) decodeOpBetween(bui *Bui, name string, args []json.RawMessage) {
+func (self *JelFiltered) decodeOpBetween(bui *Bui, name string, args []json.RawMessage) {
 	if len(args) != 3 {
 		panic(ErrInvalidInput{Err{
 			`decoding JEL op (between)`,
@@ -367,7 +382,7 @@ func (self *Jel) decodeOpBetween(bui *Bui, name string, args []json.RawMessage)
 	bui.Str(`)`)
 }
 
-func (self *Jel) decodeCast(bui *Bui, name string, args []json.RawMessage) {
+func (self *JelFiltered) decodeCast(bui *Bui, name string, args []json.RawMessage) {
 	if len(args) != 1 {
 		panic(ErrInvalidInput{Err{
 			`decoding JEL op (cast)`,
@@ -375,10 +390,10 @@ func (self *Jel) decodeCast(bui *Bui, name string, args []json.RawMessage) {
 		}})
 	}
 
-	typ := self.Type
-	field, ok := loadStructJsonPathToNestedDbFieldMap(typ)[name]
+	field, ok := self.field(`decoding JEL op (cast)`, name)
 	if !ok {
-		panic(errUnknownField(`decoding JEL op (cast)`, name, typeName(typ)))
+		bui.Str(`null`)
+		return
 	}
 
 	val := r.New(field.Field.Type)
@@ -387,14 +402,14 @@ func (self *Jel) decodeCast(bui *Bui, name string, args []json.RawMessage) {
 	bui.Arg(val.Elem().Interface())
 }
 
-func (self *Jel) decodeString(bui *Bui, input []byte) {
+func (self *JelFiltered) decodeString(bui *Bui, input []byte) {
 	var str string
 	try(json.Unmarshal(input, &str))
 
-	typ := self.Type
-	val, ok := loadStructJsonPathToNestedDbFieldMap(typ)[str]
+	val, ok := self.field(`decoding JEL string`, str)
 	if !ok {
-		panic(errUnknownField(`decoding JEL string`, str, typeName(typ)))
+		bui.Str(`null`)
+		return
 	}
 
 	bui.Set(Path(val.DbPath).AppendExpr(bui.Get()))
@@ -402,8 +417,70 @@ func (self *Jel) decodeString(bui *Bui, input []byte) {
 
 // Should be used only for numbers, bools, nulls.
 // TODO: unmarshal integers into `int64` rather than `float64`.
-func (self *Jel) decodeAny(bui *Bui, input []byte) {
+func (self *JelFiltered) decodeAny(bui *Bui, input []byte) {
 	var val any
 	try(json.Unmarshal(input, &val))
 	bui.Arg(val)
 }
+
+/*
+Finds the struct field corresponding to the given JSON path, consulting
+`.Filter`. For unknown fields, returns false in lax mode and panics otherwise.
+*/
+func (self *JelFiltered) field(while, path string) (structNestedDbField, bool) {
+	typ := self.Type
+	field, ok := loadStructJsonPathToNestedDbFieldMap(typ)[path]
+
+	if !ok || !self.filter(field.Field) {
+		if self.Lax {
+			return structNestedDbField{}, false
+		}
+		panic(errUnknownField(while, path, typeName(typ)))
+	}
+	return field, true
+}
+
+func (self *JelFiltered) filter(field r.StructField) bool {
+	return self.Filter == nil || self.Filter.AllowField(field)
+}
+
+/*
+Decodes a JEL list into its head (operator name or field path) and the remaining
+arguments. Shared between SQL transcoding and in-memory evaluation.
+*/
+func jelListHead(while string, input []byte) (string, []json.RawMessage) {
+	var list []json.RawMessage
+	err := json.Unmarshal(input, &list)
+	if err != nil {
+		panic(ErrInvalidInput{Err{
+			while,
+			fmt.Errorf(`failed to unmarshal as JSON list: %w`, err),
+		}})
+	}
+
+	if !(len(list) > 0) {
+		panic(ErrInvalidInput{Err{
+			while,
+			ErrStr(`lists must have at least one element, found empty list`),
+		}})
+	}
+
+	head, args := list[0], list[1:]
+	if !isJsonString(head) {
+		panic(ErrInvalidInput{Err{
+			while,
+			errf(`first list element must be a string, found %q`, head),
+		}})
+	}
+
+	var name string
+	err = json.Unmarshal(head, &name)
+	if err != nil {
+		panic(ErrInvalidInput{Err{
+			while,
+			fmt.Errorf(`failed to unmarshal JSON list head as string: %w`, err),
+		}})
+	}
+
+	return name, args
+}
@@ -0,0 +1,672 @@
+package sqlb
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	r "reflect"
+	"strconv"
+	"time"
+)
+
+/*
+Evaluates the expression in memory against the given value, without involving
+a database. The value must be a struct of the type stored in `.Type`, or a
+pointer to one. Field paths are resolved exactly like in `.AppendExpr`, and
+casts decode their JSON arguments into the types of the corresponding fields.
+
+The result follows SQL three-valued logic. Boolean operations return `true`,
+`false`, or `nil` which represents SQL null ("unknown"). Nulls propagate
+through comparisons, and logical operators treat them like Postgres does.
+
+Supports only a subset of `Ops`:
+
+	* Logical: "and", "or", "not".
+	* Null and boolean checks: "is null", "is true", "is unknown", and so on.
+	* Comparisons: "=", "<>", "<", ">", "<=", ">=", "is distinct from", "is not
+	  distinct from".
+	* "between" and "any".
+
+Other operations, such as regex matching or full-text search, cause an error.
+Operations missing from `Ops` are treated as casts, just like in
+`.AppendExpr`. The options of `JelFiltered` also work the same way: in lax
+mode, unknown fields evaluate to null.
+
+Values are normalized before comparison. Nil pointers are null. Values that
+implement `Nullable` or `driver.Valuer` are converted via these interfaces.
+Numbers are compared numerically regardless of their Go type. Integers,
+including JSON number literals, are compared exactly; only comparisons which
+involve floats use `float64`. Strings are compared byte-wise, which may differ
+from Postgres collations. Values of other types can only be compared with
+values of the same type.
+*/
+func (self Jel) Eval(src any) (any, error) { return JelFiltered{Jel: self}.Eval(src) }
+
+/*
+Shortcut for filtering with `.Eval`. Follows the semantics of an SQL "where"
+clause: returns true only if the expression evaluates to `true`, and false if
+it evaluates to `false` or null. Non-boolean results cause an error.
+*/
+func (self Jel) Test(src any) (bool, error) { return JelFiltered{Jel: self}.Test(src) }
+
+// Like `Jel.Eval`, respecting `.Filter` and `.Lax`.
+func (self JelFiltered) Eval(src any) (out any, err error) {
+	defer rec(&err)
+
+	eval := jelEval{JelFiltered: self, Root: valueOf(src)}
+	eval.validate()
+
+	if len(self.Text) <= 0 {
+		return true, nil
+	}
+	return eval.eval(stringToBytesUnsafe(self.Text)), nil
+}
+
+// Like `Jel.Test`, respecting `.Filter` and `.Lax`.
+func (self JelFiltered) Test(src any) (bool, error) {
+	out, err := self.Eval(src)
+	if err != nil {
+		return false, err
+	}
+
+	val, isNull := jelBool(`testing JEL`, out)
+	return !isNull && val, nil
+}
+
+type jelEval struct {
+	JelFiltered
+	Root r.Value
+}
+
+func (self *jelEval) validate() {
+	typ := typeElem(self.Type)
+	if self.Root.IsValid() && self.Root.Type() == typ {
+		return
+	}
+
+	panic(ErrInvalidInput{Err{
+		`evaluating JEL`,
+		errf(`expected a value of type %v, found %v`, typeName(typ), self.rootTypeName()),
+	}})
+}
+
+func (self *jelEval) rootTypeName() string {
+	if !self.Root.IsValid() {
+		return `nil`
+	}
+	return typeName(self.Root.Type())
+}
+
+func (self *jelEval) eval(input []byte) any {
+	input = bytes.TrimSpace(input)
+
+	if isJsonDict(input) {
+		panic(ErrInvalidInput{Err{
+			`evaluating JEL`,
+			errf(`unexpected dict in input: %q`, input),
+		}})
+	} else if isJsonList(input) {
+		return self.evalList(input)
+	} else if isJsonString(input) {
+		return self.evalString(input)
+	} else {
+		return self.evalAny(input)
+	}
+}
+
+func (self *jelEval) evalList(input []byte) any {
+	name, args := jelListHead(`evaluating JEL list`, input)
+
+	_, ok := Ops[name]
+	if !ok {
+		return self.evalCast(name, args)
+	}
+
+	switch name {
+	case `and`:
+		return self.evalAnd(name, args)
+	case `or`:
+		return self.evalOr(name, args)
+	case `not`:
+		return self.evalNot(name, args)
+	case `is null`, `is not null`,
+		`is true`, `is not true`,
+		`is false`, `is not false`,
+		`is unknown`, `is not unknown`:
+		return self.evalIs(name, args)
+	case `=`, `<>`, `<`, `>`, `<=`, `>=`,
+		`is distinct from`, `is not distinct from`:
+		return self.evalCompare(name, args)
+	case `any`:
+		return self.evalOpAny(name, args)
+	case `between`:
+		return self.evalBetween(name, args)
+	default:
+		panic(ErrInvalidInput{Err{
+			`evaluating JEL op`,
+			errf(`operation %q is not supported for in-memory evaluation`, name),
+		}})
+	}
+}
+
+func (self *jelEval) evalAnd(name string, args []json.RawMessage) any {
+	reqJelInfixArgs(name, args)
+
+	var unknown bool
+	for _, arg := range args {
+		val, isNull := jelBool(`evaluating JEL op (infix)`, self.eval(arg))
+		if isNull {
+			unknown = true
+		} else if !val {
+			return false
+		}
+	}
+
+	if unknown {
+		return nil
+	}
+	return true
+}
+
+func (self *jelEval) evalOr(name string, args []json.RawMessage) any {
+	reqJelInfixArgs(name, args)
+
+	var unknown bool
+	for _, arg := range args {
+		val, isNull := jelBool(`evaluating JEL op (infix)`, self.eval(arg))
+		if isNull {
+			unknown = true
+		} else if val {
+			return true
+		}
+	}
+
+	if unknown {
+		return nil
+	}
+	return false
+}
+
+func (self *jelEval) evalNot(name string, args []json.RawMessage) any {
+	if len(args) != 1 {
+		panic(ErrInvalidInput{Err{
+			`evaluating JEL op (prefix)`,
+			errf(`prefix operation %q must have exactly 1 argument, found %v`, name, len(args)),
+		}})
+	}
+
+	val, isNull := jelBool(`evaluating JEL op (prefix)`, self.eval(args[0]))
+	if isNull {
+		return nil
+	}
+	return !val
+}
+
+func (self *jelEval) evalIs(name string, args []json.RawMessage) any {
+	if len(args) != 1 {
+		panic(ErrInvalidInput{Err{
+			`evaluating JEL op (postfix)`,
+			errf(`postfix operation %q must have exactly 1 argument, found %v`, name, len(args)),
+		}})
+	}
+
+	src := self.eval(args[0])
+
+	switch name {
+	case `is null`:
+		return src == nil
+	case `is not null`:
+		return src != nil
+	}
+
+	val, isNull := jelBool(`evaluating JEL op (postfix)`, src)
+
+	switch name {
+	case `is true`:
+		return !isNull && val
+	case `is not true`:
+		return isNull || !val
+	case `is false`:
+		return !isNull && !val
+	case `is not false`:
+		return isNull || val
+	case `is unknown`:
+		return isNull
+	default:
+		return !isNull
+	}
+}
+
+// Infix operators are variadic and left-associative, like in SQL text
+// generated by `Jel.AppendExpr`.
+func (self *jelEval) evalCompare(name string, args []json.RawMessage) any {
+	reqJelInfixArgs(name, args)
+
+	out := self.eval(args[0])
+	for _, arg := range args[1:] {
+		out = jelCompare(name, out, self.eval(arg))
+	}
+	return out
+}
+
+func (self *jelEval) evalOpAny(name string, args []json.RawMessage) any {
+	if len(args) != 2 {
+		panic(ErrInvalidInput{Err{
+			`evaluating JEL op`,
+			errf(`operation %q must have exactly 2 arguments, found %v`, name, len(args)),
+		}})
+	}
+
+	val := self.eval(args[0])
+	src := self.eval(args[1])
+	if src == nil {
+		return nil
+	}
+
+	list := r.ValueOf(src)
+	if !(list.Kind() == r.Slice || list.Kind() == r.Array) {
+		panic(ErrInvalidInput{Err{
+			`evaluating JEL op`,
+			errf(`operation %q expected a list as the second argument, found %v`, name, typeNameOf(src)),
+		}})
+	}
+
+	var unknown bool
+	for ind := range counter(list.Len()) {
+		out := jelCompare(`=`, val, jelNorm(list.Index(ind).Interface()))
+		if out == nil {
+			unknown = true
+		} else if out == true {
+			return true
+		}
+	}
+
+	if unknown {
+		return nil
+	}
+	return false
+}
+
+func (self *jelEval) evalBetween(name string, args []json.RawMessage) any {
+	if len(args) != 3 {
+		panic(ErrInvalidInput{Err{
+			`evaluating JEL op (between)`,
+			errf(`operation %q must have exactly 3 arguments, found %v`, name, len(args)),
+		}})
+	}
+
+	val := self.eval(args[0])
+	lower := jelCompare(`>=`, val, self.eval(args[1]))
+	upper := jelCompare(`<=`, val, self.eval(args[2]))
+
+	if lower == false || upper == false {
+		return false
+	}
+	if lower == nil || upper == nil {
+		return nil
+	}
+	return true
+}
+
+func (self *jelEval) evalCast(name string, args []json.RawMessage) any {
+	if len(args) != 1 {
+		panic(ErrInvalidInput{Err{
+			`evaluating JEL op (cast)`,
+			errf(`cast into %q must have exactly 1 argument, found %v`, name, len(args)),
+		}})
+	}
+
+	field, ok := self.field(`evaluating JEL op (cast)`, name)
+	if !ok {
+		return nil
+	}
+
+	val := r.New(field.Field.Type)
+	jelUnmarshal(args[0], val.Interface())
+	return jelNorm(val.Elem().Interface())
+}
+
+func (self *jelEval) evalString(input []byte) any {
+	var str string
+	try(json.Unmarshal(input, &str))
+
+	field, ok := self.field(`evaluating JEL string`, str)
+	if !ok {
+		return nil
+	}
+
+	val := self.Root
+	for pos, ind := range field.Index {
+		if pos > 0 {
+			val = valueDerefRef(val)
+			if !val.IsValid() {
+				return nil
+			}
+		}
+		val = val.Field(ind)
+	}
+	return jelNorm(val.Interface())
+}
+
+// Should be used only for numbers, bools, nulls.
+func (self *jelEval) evalAny(input []byte) any {
+	var val any
+	jelUnmarshal(input, &val)
+	return jelNorm(val)
+}
+
+/*
+Like `json.Unmarshal`, but decodes numbers into `json.Number` rather than
+`float64` when the output is an interface, preserving the precision of large
+integers.
+*/
+func jelUnmarshal(src []byte, out any) {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+	try(dec.Decode(out))
+}
+
+/*
+Converts a JSON number to `int64` when possible, then to `uint64`, falling back
+on `float64` for fractional numbers and integers outside of these ranges.
+*/
+func jelNumber(src json.Number) any {
+	num, err := strconv.ParseInt(string(src), 10, 64)
+	if err == nil {
+		return num
+	}
+
+	unum, err := strconv.ParseUint(string(src), 10, 64)
+	if err == nil {
+		return unum
+	}
+
+	return try1(src.Float64())
+}
+
+func reqJelInfixArgs(name string, args []json.RawMessage) {
+	if !(len(args) >= 2) {
+		panic(ErrInvalidInput{Err{
+			`evaluating JEL op (infix)`,
+			errf(`infix operation %q must have at least 2 arguments, found %v`, name, len(args)),
+		}})
+	}
+}
+
+/*
+Converts an arbitrary value into one of the few representations understood by
+the evaluator: nil, bool, int64, uint64, float64, string, `time.Time`, `[]byte`,
+or a list. Unsigned integers are converted to `int64` when they fit. Other
+values are returned as-is and support only equality.
+*/
+func jelNorm(src any) any {
+	num, ok := src.(json.Number)
+	if ok {
+		return jelNumber(num)
+	}
+
+	val := valueOf(src)
+	if !val.IsValid() {
+		return nil
+	}
+
+	// Lists are preserved even when they implement `driver.Valuer`, which
+	// usually encodes them as strings.
+	if (val.Kind() == r.Slice || val.Kind() == r.Array) && !val.Type().ConvertibleTo(typeBytes) {
+		if val.Kind() == r.Slice && val.IsNil() {
+			return nil
+		}
+		return val.Interface()
+	}
+
+	src = norm(src)
+	val = valueOf(src)
+	if !val.IsValid() {
+		return nil
+	}
+
+	switch val.Kind() {
+	case r.Bool:
+		return val.Bool()
+
+	case r.Int8, r.Int16, r.Int32, r.Int64, r.Int:
+		return val.Int()
+
+	case r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uint, r.Uintptr:
+		num := val.Uint()
+		if num <= math.MaxInt64 {
+			return int64(num)
+		}
+		return num
+
+	case r.Float32, r.Float64:
+		return val.Float()
+
+	case r.String:
+		return val.String()
+
+	case r.Struct:
+		if val.Type().ConvertibleTo(typeTime) {
+			return val.Convert(typeTime).Interface()
+		}
+
+	case r.Slice:
+		return val.Bytes()
+	}
+
+	return val.Interface()
+}
+
+// Returns the boolean value and whether it's null. Panics for other types.
+func jelBool(while string, src any) (bool, bool) {
+	if src == nil {
+		return false, true
+	}
+
+	val, ok := src.(bool)
+	if !ok {
+		panic(ErrInvalidInput{Err{
+			while,
+			errf(`expected boolean or null, found %v`, typeNameOf(src)),
+		}})
+	}
+	return val, false
+}
+
+/*
+Compares two normalized values with the given operator, following SQL null
+semantics: nulls make the result null, except for "is [not] distinct from".
+*/
+func jelCompare(name string, one, two any) any {
+	switch name {
+	case `is distinct from`:
+		if one == nil || two == nil {
+			return (one == nil) != (two == nil)
+		}
+		return !jelEqual(name, one, two)
+
+	case `is not distinct from`:
+		if one == nil || two == nil {
+			return (one == nil) == (two == nil)
+		}
+		return jelEqual(name, one, two)
+	}
+
+	if one == nil || two == nil {
+		return nil
+	}
+
+	switch name {
+	case `=`:
+		return jelEqual(name, one, two)
+	case `<>`:
+		return !jelEqual(name, one, two)
+	}
+
+	ord, ok := jelOrder(one, two)
+	if !ok {
+		panic(errJelCompare(name, one, two))
+	}
+
+	switch name {
+	case `<`:
+		return ord < 0
+	case `>`:
+		return ord > 0
+	case `<=`:
+		return ord <= 0
+	default:
+		return ord >= 0
+	}
+}
+
+func jelEqual(name string, one, two any) bool {
+	ord, ok := jelOrder(one, two)
+	if ok {
+		return ord == 0
+	}
+
+	typ := r.TypeOf(one)
+	if typ == r.TypeOf(two) && typ.Comparable() {
+		return one == two
+	}
+	panic(errJelCompare(name, one, two))
+}
+
+// Returns -1, 0, or 1, and whether the values are mutually ordered.
+func jelOrder(one, two any) (int, bool) {
+	switch one := one.(type) {
+	case bool:
+		two, ok := two.(bool)
+		if ok {
+			return jelOrderBool(one, two), true
+		}
+
+	case int64:
+		switch two := two.(type) {
+		case int64:
+			return jelOrderInt(one, two), true
+		case uint64:
+			return jelOrderIntUint(one, two), true
+		case float64:
+			return jelOrderFloat(float64(one), two), true
+		}
+
+	case uint64:
+		switch two := two.(type) {
+		case int64:
+			return -jelOrderIntUint(two, one), true
+		case uint64:
+			return jelOrderUint(one, two), true
+		case float64:
+			return jelOrderFloat(float64(one), two), true
+		}
+
+	case float64:
+		switch two := two.(type) {
+		case int64:
+			return jelOrderFloat(one, float64(two)), true
+		case uint64:
+			return jelOrderFloat(one, float64(two)), true
+		case float64:
+			return jelOrderFloat(one, two), true
+		}
+
+	case string:
+		two, ok := two.(string)
+		if ok {
+			return jelOrderString(one, two), true
+		}
+
+	case time.Time:
+		two, ok := two.(time.Time)
+		if ok {
+			return jelOrderTime(one, two), true
+		}
+
+	case []byte:
+		two, ok := two.([]byte)
+		if ok {
+			return bytes.Compare(one, two), true
+		}
+	}
+
+	return 0, false
+}
+
+func jelOrderBool(one, two bool) int {
+	if one == two {
+		return 0
+	}
+	if two {
+		return -1
+	}
+	return 1
+}
+
+func jelOrderInt(one, two int64) int {
+	if one < two {
+		return -1
+	}
+	if one > two {
+		return 1
+	}
+	return 0
+}
+
+func jelOrderUint(one, two uint64) int {
+	if one < two {
+		return -1
+	}
+	if one > two {
+		return 1
+	}
+	return 0
+}
+
+func jelOrderIntUint(one int64, two uint64) int {
+	if one < 0 {
+		return -1
+	}
+	return jelOrderUint(uint64(one), two)
+}
+
+func jelOrderFloat(one, two float64) int {
+	if one < two {
+		return -1
+	}
+	if one > two {
+		return 1
+	}
+	return 0
+}
+
+func jelOrderTime(one, two time.Time) int {
+	if one.Before(two) {
+		return -1
+	}
+	if one.After(two) {
+		return 1
+	}
+	return 0
+}
+
+func jelOrderString(one, two string) int {
+	if one < two {
+		return -1
+	}
+	if one > two {
+		return 1
+	}
+	return 0
+}
+
+func errJelCompare(name string, one, two any) ErrInvalidInput {
+	return ErrInvalidInput{Err{
+		`evaluating JEL op`,
+		errf(
+			`operation %q can't compare values of types %v and %v`,
+			name, typeNameOf(one), typeNameOf(two),
+		),
+	}}
+}
@@ -0,0 +1,466 @@
+package sqlb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Parses a compact s-expression syntax for JEL, converting it into the equivalent
+JSON form and storing the result in `.Text`. The resulting `Jel` behaves
+exactly like one decoded from JSON: it uses the same whitelist of operations
+(`Ops`) and the same field path resolution, consulting `.Type`. Unknown fields
+and malformed input are reported with line and column positions. On error,
+`.Text` is left unchanged. Empty input is valid and produces an empty
+expression. Example:
+
+	(and (= name "some name") (> age 10) (is not null createdAt))
+
+Which is equivalent to the following JEL JSON:
+
+	["and",
+		["=", "name", ["name", "some name"]],
+		[">", "age", 10],
+		["is not null", "createdAt"]
+	]
+
+Syntax rules:
+
+	* Lists are delimited by parens. The head of the list is an operation from
+	  `Ops` or a field path for a cast. Multi-word operations such as "is not
+	  null" are written as separate words and matched greedily.
+
+	* Bare words in argument positions are field paths, such as `name` or
+	  `outer.inner`, except for `true`, `false`, `null`, and numbers, which are
+	  literals.
+
+	* String literals use double quotes and JSON escapes. Because JEL requires
+	  string values to be cast into a field's type, a string literal is
+	  automatically cast into the type of the first field path among the other
+	  arguments of the same operation. When there's no such field, the cast must
+	  be explicit: `(name "some name")`.
+
+	* Brackets denote arrays of literals, which are allowed only inside explicit
+	  casts: `(any id (ids [10 20 30]))`.
+*/
+func (self *Jel) ParseSexpr(src string) error {
+	tar := JelFiltered{Jel: *self}
+	err := tar.ParseSexpr(src)
+	*self = tar.Jel
+	return err
+}
+
+// Like `(*Jel).ParseSexpr`, respecting `.Filter` and `.Lax`.
+func (self *JelFiltered) ParseSexpr(src string) (err error) {
+	defer rec(&err)
+	par := jelSexprParser{JelFiltered: self, Source: src}
+	self.Text = par.parse()
+	return
+}
+
+const (
+	jelSexprList jelSexprKind = iota + 1
+	jelSexprArray
+	jelSexprIdent
+	jelSexprString
+	jelSexprLiteral
+)
+
+type jelSexprKind byte
+
+type jelSexprNode struct {
+	Kind jelSexprKind
+	Pos  int
+	Text string
+	Args []jelSexprNode
+}
+
+type jelSexprParser struct {
+	*JelFiltered
+	Source   string
+	cursor   int
+	maxWords int
+}
+
+func (self *jelSexprParser) parse() string {
+	self.maxWords = jelOpMaxWords()
+	self.skipSpace()
+	if !self.more() {
+		return ``
+	}
+
+	node := self.node()
+	self.skipSpace()
+	if self.more() {
+		panic(self.err(self.cursor, errf(`unexpected %q after the end of expression`, self.headChar())))
+	}
+
+	return bytesToMutableString(self.emit(nil, node, ``))
+}
+
+func (self *jelSexprParser) node() jelSexprNode {
+	self.skipSpace()
+	if !self.more() {
+		panic(self.errEOF(`expression`))
+	}
+
+	switch self.headByte() {
+	case '(':
+		return self.list()
+	case '[':
+		return self.array()
+	case '"':
+		return self.quoted()
+	case ')', ']':
+		panic(self.err(self.cursor, errf(`unexpected %q`, self.headChar())))
+	default:
+		return self.word()
+	}
+}
+
+func (self *jelSexprParser) list() jelSexprNode {
+	pos := self.cursor
+	self.cursor++
+	self.skipSpace()
+
+	if !self.more() {
+		panic(self.errEOF(`")"`))
+	}
+	if self.headByte() == ')' {
+		panic(self.err(pos, ErrStr(`lists must have at least one element, found empty list`)))
+	}
+	if !self.isWordStart() {
+		panic(self.err(self.cursor, errf(
+			`list must begin with an operation or a field path, found %q`, self.headChar(),
+		)))
+	}
+
+	out := jelSexprNode{Kind: jelSexprList, Pos: self.cursor, Text: self.head()}
+
+	for {
+		self.skipSpace()
+		if !self.more() {
+			panic(self.errEOF(`")"`))
+		}
+		if self.headByte() == ')' {
+			self.cursor++
+			break
+		}
+		out.Args = append(out.Args, self.node())
+	}
+
+	self.validateList(out)
+	return out
+}
+
+/*
+Reads the list head. Multi-word operations are matched greedily: we read as
+many words as the longest operation in `Ops` may have, and pick the longest
+sequence which is a known operation. Otherwise the head is a single word.
+*/
+func (self *jelSexprParser) head() string {
+	start := self.cursor
+	ends := make([]int, 0, 4)
+
+	for len(ends) < self.maxWords {
+		if len(ends) > 0 {
+			self.skipSpace()
+		}
+		if !self.more() || !self.isWordStart() {
+			break
+		}
+		self.skipWord()
+		ends = append(ends, self.cursor)
+	}
+
+	for ind := len(ends) - 1; ind > 0; ind-- {
+		name := joinWords(self.Source[start:ends[ind]])
+		_, ok := Ops[name]
+		if ok {
+			self.cursor = ends[ind]
+			return name
+		}
+	}
+
+	self.cursor = ends[0]
+	return self.Source[start:ends[0]]
+}
+
+func (self *jelSexprParser) array() jelSexprNode {
+	out := jelSexprNode{Kind: jelSexprArray, Pos: self.cursor}
+	self.cursor++
+
+	for {
+		self.skipSpace()
+		if !self.more() {
+			panic(self.errEOF(`"]"`))
+		}
+		if self.headByte() == ']' {
+			self.cursor++
+			return out
+		}
+
+		val := self.node()
+		if !(val.Kind == jelSexprString || val.Kind == jelSexprLiteral || val.Kind == jelSexprArray) {
+			panic(self.err(val.Pos, ErrStr(`arrays may contain only literals`)))
+		}
+		out.Args = append(out.Args, val)
+	}
+}
+
+func (self *jelSexprParser) quoted() jelSexprNode {
+	start := self.cursor
+	self.cursor++
+
+	for self.more() {
+		char := self.headByte()
+		self.cursor++
+
+		if char == '\\' {
+			if self.more() {
+				self.cursor++
+			}
+			continue
+		}
+
+		if char == '"' {
+			text := self.Source[start:self.cursor]
+			if !json.Valid(stringToBytesUnsafe(text)) {
+				panic(self.err(start, errf(`invalid string literal %v`, text)))
+			}
+			return jelSexprNode{Kind: jelSexprString, Pos: start, Text: text}
+		}
+	}
+
+	panic(self.errEOF(`closing '"'`))
+}
+
+func (self *jelSexprParser) word() jelSexprNode {
+	start := self.cursor
+	self.skipWord()
+	text := self.Source[start:self.cursor]
+
+	if isJelSexprLiteral(text) {
+		return jelSexprNode{Kind: jelSexprLiteral, Pos: start, Text: text}
+	}
+	return jelSexprNode{Kind: jelSexprIdent, Pos: start, Text: text}
+}
+
+func (self *jelSexprParser) validateList(node jelSexprNode) {
+	op, ok := Ops[node.Text]
+	if !ok {
+		self.validateCast(node)
+		return
+	}
+
+	count := len(node.Args)
+
+	switch op {
+	case OpPrefix, OpPostfix:
+		if count != 1 {
+			panic(self.err(node.Pos, errf(`operation %q must have exactly 1 argument, found %v`, node.Text, count)))
+		}
+	case OpInfix:
+		if !(count >= 2) {
+			panic(self.err(node.Pos, errf(`operation %q must have at least 2 arguments, found %v`, node.Text, count)))
+		}
+	case OpAny:
+		if count != 2 {
+			panic(self.err(node.Pos, errf(`operation %q must have exactly 2 arguments, found %v`, node.Text, count)))
+		}
+	case OpBetween:
+		if count != 3 {
+			panic(self.err(node.Pos, errf(`operation %q must have exactly 3 arguments, found %v`, node.Text, count)))
+		}
+	}
+
+	for _, arg := range node.Args {
+		if arg.Kind == jelSexprArray {
+			panic(self.err(arg.Pos, ErrStr(`arrays are allowed only inside explicit casts`)))
+		}
+	}
+}
+
+func (self *jelSexprParser) validateCast(node jelSexprNode) {
+	self.validateField(node.Pos, node.Text)
+
+	if len(node.Args) != 1 {
+		panic(self.err(node.Pos, errf(`cast into %q must have exactly 1 argument, found %v`, node.Text, len(node.Args))))
+	}
+
+	arg := node.Args[0]
+	if !(arg.Kind == jelSexprString || arg.Kind == jelSexprLiteral || arg.Kind == jelSexprArray) {
+		panic(self.err(arg.Pos, errf(`cast into %q requires a literal argument`, node.Text)))
+	}
+}
+
+func (self *jelSexprParser) validateField(pos int, path string) {
+	self.field(`parsing JEL s-expression at `+self.position(pos), path)
+}
+
+/*
+Appends the JSON representation of the node. The field path is used for
+casting string literals, and may be empty.
+*/
+func (self *jelSexprParser) emit(buf []byte, node jelSexprNode, field string) []byte {
+	switch node.Kind {
+	case jelSexprIdent:
+		self.validateField(node.Pos, node.Text)
+		return appendJsonString(buf, node.Text)
+
+	case jelSexprLiteral:
+		return append(buf, node.Text...)
+
+	case jelSexprString:
+		if field == `` {
+			panic(self.err(node.Pos, errf(
+				`unable to infer the type of string literal %v: no field path among the sibling arguments; use an explicit cast such as (fieldName %v)`,
+				node.Text, node.Text,
+			)))
+		}
+		buf = append(buf, '[')
+		buf = appendJsonString(buf, field)
+		buf = append(buf, ',')
+		buf = append(buf, node.Text...)
+		buf = append(buf, ']')
+		return buf
+
+	case jelSexprArray:
+		buf = append(buf, '[')
+		for ind, val := range node.Args {
+			if ind > 0 {
+				buf = append(buf, ',')
+			}
+			buf = self.emitRaw(buf, val)
+		}
+		buf = append(buf, ']')
+		return buf
+
+	default:
+		return self.emitList(buf, node)
+	}
+}
+
+func (self *jelSexprParser) emitList(buf []byte, node jelSexprNode) []byte {
+	buf = append(buf, '[')
+	buf = appendJsonString(buf, node.Text)
+
+	_, isOp := Ops[node.Text]
+	field := jelSexprFieldArg(node.Args)
+
+	for _, arg := range node.Args {
+		buf = append(buf, ',')
+		if isOp {
+			buf = self.emit(buf, arg, field)
+		} else {
+			buf = self.emitRaw(buf, arg)
+		}
+	}
+
+	buf = append(buf, ']')
+	return buf
+}
+
+// Used for cast arguments and array elements, which are never cast.
+func (self *jelSexprParser) emitRaw(buf []byte, node jelSexprNode) []byte {
+	if node.Kind == jelSexprString {
+		return append(buf, node.Text...)
+	}
+	return self.emit(buf, node, ``)
+}
+
+func (self *jelSexprParser) skipSpace() {
+	for self.more() && charsetWhitespace.has(self.headByte()) {
+		self.cursor++
+	}
+}
+
+func (self *jelSexprParser) skipWord() {
+	for self.more() && self.isWordStart() {
+		self.cursor++
+	}
+}
+
+func (self *jelSexprParser) isWordStart() bool {
+	char := self.headByte()
+	return !charsetWhitespace.has(char) && !charsetJelSexprDelim.has(char)
+}
+
+func (self *jelSexprParser) more() bool { return self.cursor < len(self.Source) }
+
+func (self *jelSexprParser) headByte() byte { return self.Source[self.cursor] }
+
+func (self *jelSexprParser) headChar() rune {
+	char, _ := utf8.DecodeRuneInString(self.Source[self.cursor:])
+	return char
+}
+
+// Returns a human-readable position with 1-based line and column.
+func (self *jelSexprParser) position(pos int) string {
+	prefix := self.Source[:pos]
+	line := strings.Count(prefix, "\n") + 1
+	col := utf8.RuneCountInString(prefix[strings.LastIndexByte(prefix, '\n')+1:]) + 1
+	return fmt.Sprintf(`line %v, column %v`, line, col)
+}
+
+func (self *jelSexprParser) err(pos int, cause error) ErrInvalidInput {
+	return ErrInvalidInput{Err{`parsing JEL s-expression at ` + self.position(pos), cause}}
+}
+
+func (self *jelSexprParser) errEOF(exp string) ErrUnexpectedEOF {
+	return ErrUnexpectedEOF{Err{
+		`parsing JEL s-expression at ` + self.position(self.cursor),
+		errf(`expected %v, got unexpected end of input`, exp),
+	}}
+}
+
+var charsetJelSexprDelim = new(charset).addStr(`()[]"`)
+
+// Returns the first argument which is a field path, if any.
+func jelSexprFieldArg(args []jelSexprNode) string {
+	for _, arg := range args {
+		if arg.Kind == jelSexprIdent {
+			return arg.Text
+		}
+	}
+	return ``
+}
+
+func isJelSexprLiteral(val string) bool {
+	switch val {
+	case `true`, `false`, `null`:
+		return true
+	}
+	return len(val) > 0 &&
+		(charsetDigitDec.has(val[0]) || val[0] == '-') &&
+		json.Valid(stringToBytesUnsafe(val))
+}
+
+// Returns the maximum amount of space-separated words in a known operation.
+func jelOpMaxWords() (out int) {
+	for key := range Ops {
+		count := strings.Count(key, ` `) + 1
+		if count > out {
+			out = count
+		}
+	}
+	return
+}
+
+// Collapses any whitespace between words into single spaces.
+func joinWords(val string) string {
+	return strings.Join(strings.Fields(val), ` `)
+}
+
+// Unlike `json.Marshal`, doesn't escape HTML characters such as ">", keeping
+// the output readable.
+func appendJsonString(buf []byte, val string) []byte {
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	try(enc.Encode(val))
+	return append(buf, bytes.TrimSuffix(out.Bytes(), []byte("\n"))...)
+}
@@ -0,0 +1,358 @@
+package sqlb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	r "reflect"
+	"strings"
+)
+
+/*
+Keyset pagination, also known as cursor pagination. An alternative to
+`Offset`/`OffsetUint` which doesn't degrade on large tables. Implements `Expr`,
+generating a condition for a "where" clause that selects the rows located
+after the last-seen row, according to `.Ords`. Usage:
+
+	* Parse client orderings into `ParserOrds` and call `.Keyset`.
+	* Decode the client-provided cursor via `.ParseCursor`, if any.
+	* Use the keyset in a "where" clause, together with the same `Ords` for
+	  "order by" and a limit.
+	* After fetching a page, call `.SetLast` with the last row, and return
+	  `.Cursor` to the client.
+
+`.Ords` must consist of column orderings such as `Path`, `Ord`, or `OrdAsc`,
+which is what `OrdsParser` produces. Every column path must correspond to a
+DB-tagged field of `.Type`. Arbitrary ordering expressions are not supported.
+For deterministic results, the orderings should end with a unique column such
+as a primary key.
+
+`.Vals` contains the field values of the last-seen row corresponding to the
+orderings. When empty, this represents the first page, and the condition is
+`true`. Otherwise, the condition is a disjunction of row comparisons, which is
+equivalent to `(a, b) > ($1, $2)`, but supports mixed directions and
+respects the placement of nulls. For example, for `Ords{OrdAsc{"a"},
+OrdDesc{"b"}}`:
+
+	(("a" > $1 or "a" is null) or ("a" = $1 and "b" < $2))
+
+Unspecified nulls placement is treated like in Postgres: "nulls last" for
+ascending order, and "nulls first" for descending order.
+*/
+type Keyset struct {
+	Ords Ords
+	Type r.Type
+	Vals []any
+}
+
+/*
+If `.Type` is empty, sets the type of the provided value. Otherwise this is a
+nop. The input is used only as a type carrier; its actual value is ignored.
+*/
+func (self *Keyset) OrType(typ any) {
+	if self.Type == nil {
+		self.Type = typeElemOf(typ)
+	}
+}
+
+/*
+Sets `.Vals` from the given row, which must be a struct of the type `.Type` or
+a pointer to such a struct. If `.Type` is empty, it's set to the row's type. A
+nil row empties `.Vals`, which represents the first page.
+*/
+func (self *Keyset) SetLast(row any) (err error) {
+	defer rec(&err)
+	self.Vals = self.Vals[:0]
+
+	val := valueDeref(valueOf(row))
+	if !val.IsValid() {
+		return
+	}
+
+	self.OrType(row)
+	self.reqType(`reading keyset values from row`, val.Type())
+
+	for _, ord := range self.ords() {
+		self.Vals = append(self.Vals, keysetFieldValue(val, self.field(ord).Index))
+	}
+	return
+}
+
+/*
+Encodes `.Vals` into an opaque string suitable for clients. The resulting
+cursor includes a hash of the orderings, and can be decoded only for the same
+orderings and type. The hash avoids exposing column names to clients. Empty
+`.Vals` produce an empty string.
+*/
+func (self Keyset) Cursor() (_ string, err error) {
+	defer rec(&err)
+	if len(self.Vals) <= 0 {
+		return ``, nil
+	}
+
+	self.reqVals(`encoding keyset cursor`)
+
+	src := try1(json.Marshal(keysetCursor{self.ordsHash(), self.Vals}))
+	return base64.RawURLEncoding.EncodeToString(src), nil
+}
+
+/*
+Decodes a cursor previously created by `.Cursor`, setting `.Vals`. Consults
+`.Ords` and `.Type` to decode each value into the type of the corresponding
+struct field. An empty string empties `.Vals`, which represents the first page.
+*/
+func (self *Keyset) ParseCursor(src string) (err error) {
+	defer rec(&err)
+	self.Vals = self.Vals[:0]
+
+	if src == `` {
+		return
+	}
+
+	const while = `decoding keyset cursor`
+
+	text, err := base64.RawURLEncoding.DecodeString(src)
+	if err != nil {
+		panic(ErrInvalidInput{Err{while, err}})
+	}
+
+	var cursor keysetCursorRaw
+	err = json.Unmarshal(text, &cursor)
+	if err != nil {
+		panic(ErrInvalidInput{Err{while, err}})
+	}
+
+	if cursor.Ords != self.ordsHash() {
+		panic(ErrInvalidInput{Err{while, ErrStr(`cursor doesn't match the current ordering`)}})
+	}
+
+	ords := self.ords()
+	if len(cursor.Vals) != len(ords) {
+		panic(ErrInvalidInput{Err{
+			while,
+			errf(`expected %v values, found %v`, len(ords), len(cursor.Vals)),
+		}})
+	}
+
+	for ind, ord := range ords {
+		ptr := r.New(self.field(ord).Field.Type)
+		err := json.Unmarshal(cursor.Vals[ind], ptr.Interface())
+		if err != nil {
+			panic(ErrInvalidInput{Err{while, err}})
+		}
+		self.Vals = append(self.Vals, ptr.Elem().Interface())
+	}
+	return
+}
+
+// Implement the `Expr` interface, making this a sub-expression.
+func (self Keyset) AppendExpr(text []byte, args []any) ([]byte, []any) {
+	bui := Bui{text, args}
+
+	if len(self.Vals) <= 0 {
+		bui.Str(`true`)
+		return bui.Get()
+	}
+
+	ords := self.reqVals(`generating keyset condition`)
+	vals := make([]any, len(self.Vals))
+	for ind, val := range self.Vals {
+		vals[ind] = norm(val)
+	}
+
+	var count int
+	for ind, ord := range ords {
+		if ord.hasAfter(vals[ind]) {
+			count++
+		}
+	}
+
+	if count <= 0 {
+		bui.Str(`false`)
+		return bui.Get()
+	}
+
+	if count > 1 {
+		bui.Str(`(`)
+	}
+
+	var found bool
+	for ind, ord := range ords {
+		val := vals[ind]
+		if !ord.hasAfter(val) {
+			continue
+		}
+
+		if found {
+			bui.Str(`or`)
+		}
+		found = true
+
+		if ind > 0 {
+			bui.Str(`(`)
+			for prev, ord := range ords[:ind] {
+				ord.appendEq(&bui, vals[prev])
+				bui.Str(`and`)
+			}
+		}
+
+		ord.appendAfter(&bui, val)
+
+		if ind > 0 {
+			bui.Str(`)`)
+		}
+	}
+
+	if count > 1 {
+		bui.Str(`)`)
+	}
+	return bui.Get()
+}
+
+// Implement the `AppenderTo` interface, sometimes allowing more efficient text
+// encoding.
+func (self Keyset) AppendTo(text []byte) []byte { return exprAppend(self, text) }
+
+// Implement the `fmt.Stringer` interface for debug purposes.
+func (self Keyset) String() string { return exprString(self) }
+
+func (self Keyset) ords() []keysetOrd {
+	out := make([]keysetOrd, 0, len(self.Ords))
+	for _, val := range self.Ords {
+		if val != nil {
+			out = append(out, toKeysetOrd(val))
+		}
+	}
+	return out
+}
+
+// Used in cursors instead of the orderings, which may reveal column names.
+func (self Keyset) ordsHash() string {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(self.Ords.String()))
+	return fmt.Sprintf(`%016x`, hash.Sum64())
+}
+
+func (self Keyset) reqVals(while string) []keysetOrd {
+	ords := self.ords()
+	if len(ords) != len(self.Vals) {
+		panic(ErrInvalidInput{Err{
+			while,
+			errf(`mismatch between orderings and values: %v orderings, %v values`, len(ords), len(self.Vals)),
+		}})
+	}
+	for _, ord := range ords {
+		self.field(ord)
+	}
+	return ords
+}
+
+func (self Keyset) reqType(while string, typ r.Type) {
+	exp := typeElem(self.Type)
+	if typ != exp {
+		panic(ErrInvalidInput{Err{
+			while,
+			errf(`expected a value of type %v, found %v`, typeName(exp), typeName(typ)),
+		}})
+	}
+}
+
+func (self Keyset) field(ord keysetOrd) structNestedDbField {
+	path := strings.Join(ord.Path, `.`)
+	field, ok := loadStructDbPathToNestedDbFieldMap(self.Type)[path]
+	if !ok {
+		panic(ErrUnknownField{Err{
+			`resolving keyset ordering`,
+			errf(`no field corresponding to DB path %q in type %v`, path, typeName(typeElem(self.Type))),
+		}})
+	}
+	return field
+}
+
+type keysetCursor struct {
+	Ords string `json:"ords"`
+	Vals []any  `json:"vals"`
+}
+
+type keysetCursorRaw struct {
+	Ords string            `json:"ords"`
+	Vals []json.RawMessage `json:"vals"`
+}
+
+type keysetOrd Ord
+
+func toKeysetOrd(val Expr) keysetOrd {
+	ord, ok := toOrd(val)
+	if !ok {
+		panic(ErrInvalidInput{Err{
+			`resolving keyset ordering`,
+			errf(`unsupported ordering expression of type %v; expected a column ordering such as Path or Ord`, typeNameOf(val)),
+		}})
+	}
+	return keysetOrd(ord)
+}
+
+// Matches the Postgres default: nulls are larger than any value.
+func (self keysetOrd) nullsFirst() bool {
+	if self.Nulls == NullsNone {
+		return self.Dir == DirDesc
+	}
+	return self.Nulls == NullsFirst
+}
+
+/*
+False if no value can come after the given value. This happens when the given
+value is null and nulls come last.
+*/
+func (self keysetOrd) hasAfter(val any) bool {
+	return val != nil || self.nullsFirst()
+}
+
+func (self keysetOrd) appendEq(bui *Bui, val any) {
+	bui.Set(self.Path.AppendExpr(bui.Get()))
+	bui.Set(Eq{nil, val}.AppendRhs(bui.Get()))
+}
+
+// Appends the condition "column value comes after the given value".
+func (self keysetOrd) appendAfter(bui *Bui, val any) {
+	if val == nil {
+		bui.Set(self.Path.AppendExpr(bui.Get()))
+		bui.Set(Neq{nil, nil}.AppendRhs(bui.Get()))
+		return
+	}
+
+	nullsLast := !self.nullsFirst()
+	if nullsLast {
+		bui.Str(`(`)
+	}
+
+	bui.Set(self.Path.AppendExpr(bui.Get()))
+	if self.Dir == DirDesc {
+		bui.Str(`<`)
+	} else {
+		bui.Str(`>`)
+	}
+	bui.Arg(val)
+
+	if nullsLast {
+		bui.Str(`or`)
+		self.appendEq(bui, nil)
+		bui.Str(`)`)
+	}
+}
+
+/*
+The field index is built from types dereferenced via `typeDeref`, which also
+unwraps "ref" wrappers, so values must be unwrapped the same way.
+*/
+func keysetFieldValue(val r.Value, index []int) any {
+	for _, ind := range index {
+		val = valueDerefRef(val)
+		if !val.IsValid() {
+			return nil
+		}
+		val = val.Field(ind)
+	}
+	return val.Interface()
+}
@@ -48,9 +48,10 @@ func TypeColsDeep(typ r.Type) string {
 Returns a parsed `Prep` for the given source string. Panics if parsing fails.
 Caches the result for each source string, reusing it for future calls. Used
 internally by `StrQ`. User code shouldn't have to call this, but it's exported
-just in case.
+just in case. The caching policy is configurable via `SetPrepCache`, and can be
+observed via `PrepCacheStats`.
 */
-func Preparse(val string) Prep { return prepCache.Get(val) }
+func Preparse(val string) Prep { return preparse(val) }
 
 // Shortcut for `StrQ{text, List(args)}`.
 func ListQ(text string, args ...any) StrQ {
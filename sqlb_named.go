@@ -0,0 +1,149 @@
+package sqlb
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+/*
+Enum for the syntax of named parameters generated by `ToNamedArgs`, for drivers
+that accept named arguments via `sql.NamedArg`:
+
+	* `NamedParamAt`: "@name". Used by SQL Server, and supported by SQLite.
+	* `NamedParamColon`: ":name". Used by Oracle, and supported by SQLite.
+	* `NamedParamDollar`: "$name". Supported by SQLite.
+*/
+type NamedParamStyle byte
+
+const (
+	NamedParamAt NamedParamStyle = iota
+	NamedParamColon
+	NamedParamDollar
+)
+
+// Returns the prefix of named parameters in this style, such as "@".
+func (self NamedParamStyle) Prefix() byte {
+	switch self {
+	case NamedParamColon:
+		return ':'
+	case NamedParamDollar:
+		return '$'
+	default:
+		return '@'
+	}
+}
+
+/*
+Renders the query like `(StrQ).ReifyBindings`, then converts the output via
+`ToNamedArgs`, preserving the names of named parameters.
+*/
+func (self StrQ) ReifyNamed(style NamedParamStyle) (string, []sql.NamedArg) {
+	text, args, binds := self.ReifyBindings()
+	return ToNamedArgs(style, text, args, binds)
+}
+
+/*
+Renders the expressions like `Reify`, then converts the output via
+`ToNamedArgs`. Since arbitrary expressions don't report parameter names, all
+names are generated. For preserving names, use `(StrQ).ReifyNamed`.
+*/
+func ReifyNamed(style NamedParamStyle, vals ...Expr) (string, []sql.NamedArg) {
+	text, args := Reify(vals...)
+	return ToNamedArgs(style, text, args, nil)
+}
+
+/*
+Converts the output of `Reify` or `(StrQ).ReifyBindings` from ordinal
+parameters such as "$1" into named parameters such as "@name", returning
+arguments as `sql.NamedArg`, for drivers which accept named arguments. The
+bindings, which may be nil, determine the names:
+
+	* An ordinal bound to a named parameter such as ":user_id" gets the same
+	  name, such as "@user_id". Dots in paths such as ":filter.min_age" are
+	  replaced with underscores. Because `sql.Named` requires names to begin
+	  with a letter, other names such as ":_id" are prefixed with "p", such as
+	  "@p_id".
+	* Other ordinals, including arguments generated by struct expressions and
+	  by nested `StrQ`, get generated names such as "@p1", where the number is
+	  the original ordinal.
+
+Generated and converted names are made unique by appending underscores.
+Ordinal parameters in quoted strings and comments are left as-is.
+*/
+func ToNamedArgs(style NamedParamStyle, text string, args []any, binds []ParamBinding) (string, []sql.NamedArg) {
+	names := namedArgNames(len(args), binds)
+
+	buf := make([]byte, 0, len(text)+len(args)*4)
+	tok := Tokenizer{Source: text}
+
+	for {
+		val := tok.Next()
+		if val.IsInvalid() {
+			break
+		}
+
+		if val.Type == TokenTypeOrdinalParam {
+			ind := val.ParseOrdinalParam().Index()
+			if ind >= 0 && ind < len(names) {
+				buf = append(buf, style.Prefix())
+				buf = append(buf, names[ind]...)
+				continue
+			}
+		}
+		buf = append(buf, val.Text...)
+	}
+
+	out := make([]sql.NamedArg, len(args))
+	for ind, val := range args {
+		out[ind] = sql.Named(names[ind], val)
+	}
+	return bytesToMutableString(buf), out
+}
+
+// Returns a unique name for each argument index.
+func namedArgNames(count int, binds []ParamBinding) []string {
+	out := make([]string, count)
+	used := make(map[string]struct{}, count)
+
+	claim := func(ind int, name string) {
+		for {
+			if _, ok := used[name]; !ok {
+				break
+			}
+			name += `_`
+		}
+		used[name] = struct{}{}
+		out[ind] = name
+	}
+
+	for _, val := range binds {
+		ind := val.Ordinal.Index()
+		if ind < 0 || ind >= count || out[ind] != `` {
+			continue
+		}
+
+		name := strings.TrimPrefix(val.Param, string(namedParamPrefix))
+		if name == val.Param {
+			continue
+		}
+		claim(ind, namedArgName(name))
+	}
+
+	for ind := range out {
+		if out[ind] == `` {
+			claim(ind, `p`+strconv.Itoa(ind+1))
+		}
+	}
+	return out
+}
+
+// Converts a named parameter, without its prefix, into a valid `sql.NamedArg`
+// name.
+func namedArgName(val string) string {
+	val = strings.ReplaceAll(val, `.`, `_`)
+	if len(val) > 0 && val[0] != '_' && charsetIdentStart.has(val[0]) {
+		return val
+	}
+	return `p` + val
+}
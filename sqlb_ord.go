@@ -20,8 +20,9 @@ some edge issues. For example, this allows an empty `ParserOrds` to be encoded
 as JSON `null` rather than a struct, allowing types that include it as a field
 to be used for encoding JSON, not just decoding it. However, this doesn't make
 ords encoding/decoding actually reversible. Decoding "consults" a struct type
-to convert JSON field names to DB column names. Ideally, JSON marshaling would
-perform the same process in reverse, which is not currently implemented.
+to convert JSON field names to DB column names. For the reverse conversion,
+use `ParserOrds.Strings` or `ParserOrds.MarshalText`, which know the struct
+type.
 */
 func (self Ords) MarshalJSON() ([]byte, error) {
 	return json.Marshal([]Expr(self))
@@ -207,6 +208,40 @@ func (self Ord) String() string { return AppenderString(&self) }
 // True if the path is empty.
 func (self Ord) IsEmpty() bool { return len(self.Path) <= 0 }
 
+/*
+Converts a column ordering expression, such as `Ident`, `Path`, `OrdAsc` or
+`OrdDescNullsLast`, into the equivalent `Ord`. Returns false for other
+expressions.
+*/
+func toOrd(val Expr) (Ord, bool) {
+	switch val := val.(type) {
+	case Ident:
+		return Ord{Path: Path{string(val)}}, true
+	case Path:
+		return Ord{Path: val}, true
+	case Ord:
+		return val, true
+	case OrdAsc:
+		return Ord{Path(val), DirAsc, NullsNone}, true
+	case OrdDesc:
+		return Ord{Path(val), DirDesc, NullsNone}, true
+	case OrdNullsFirst:
+		return Ord{Path(val), DirNone, NullsFirst}, true
+	case OrdNullsLast:
+		return Ord{Path(val), DirNone, NullsLast}, true
+	case OrdAscNullsFirst:
+		return Ord{Path(val), DirAsc, NullsFirst}, true
+	case OrdAscNullsLast:
+		return Ord{Path(val), DirAsc, NullsLast}, true
+	case OrdDescNullsFirst:
+		return Ord{Path(val), DirDesc, NullsFirst}, true
+	case OrdDescNullsLast:
+		return Ord{Path(val), DirDesc, NullsLast}, true
+	default:
+		return Ord{}, false
+	}
+}
+
 // Same as `Ord{Path: path, Dir: DirAsc}` but more syntactically convenient
 // and uses less memory.
 type OrdAsc []string
@@ -3,6 +3,7 @@ package sqlb
 import (
 	"encoding/json"
 	r "reflect"
+	"strings"
 	"unsafe"
 )
 
@@ -29,6 +30,33 @@ type ParseOpt struct {
 	unknown JSON fields cause ords parsing to fail with a descriptive error.
 	*/
 	Lax bool
+
+	/**
+	Optional default orderings, in the comma-separated format supported by
+	`.ParseText`, such as "-createdAt,name.asc". Used when the input produces no
+	orderings, for example when it's empty, or when all its fields are unknown
+	and `.Lax` is true. Unlike client input, default orderings ignore `.Filter`
+	and `.Lax`, and unknown fields always cause a parse error. This is a string
+	rather than a slice to keep `ParseOpt` comparable.
+	*/
+	Default string
+
+	/**
+	Optional limit on the amount of orderings accepted from the input. When
+	positive, inputs with more orderings cause a parse error. Doesn't apply to
+	`.Default` and `.Tiebreak`.
+	*/
+	Max int
+
+	/**
+	Optional JSON path of a unique field, such as a primary key. When non-empty,
+	an ordering by this field is appended to the parsed orderings, unless they
+	already order by the same column. Ensures that the resulting order is total,
+	which is required for stable pagination. Like `.Default`, this ignores
+	`.Filter` and `.Lax`. The ordering respects the field's "ord.dir" and
+	"ord.nulls" tags, if any.
+	*/
+	Tiebreak string
 }
 
 /*
@@ -78,12 +106,91 @@ Each path can be a single identifier or dot-separated:
 
 The path MUST correspond to JSON-tagged fields in the reference struct type,
 which MUST have corresponding DB column names. The parsed ordering uses DB
-column names, rather than the original JSON names.
+column names, rather than the original JSON names. Alternatively, the path may
+be the name of an ordering expression registered by the struct type via
+`OrdExprer`, which produces an `Ordering` with that expression.
 */
 func (self *ParserOrds) ParseSlice(src []string) error {
 	return OrdsParser{&self.Ords, self.ParseOpt}.ParseSlice(src)
 }
 
+/*
+Implement `encoding.TextUnmarshaler`, allowing to decode orderings from URL
+queries and other text inputs. See the method `.ParseText` for docs.
+*/
+func (self *ParserOrds) UnmarshalText(src []byte) error {
+	return OrdsParser{&self.Ords, self.ParseOpt}.UnmarshalText(src)
+}
+
+/*
+Parses a comma-separated list of orderings, using common URL conventions.
+Ignores empty items and whitespace around commas. Each item may use the same
+format as `.ParseSlice`, or the following shortcuts:
+
+	-path             -> path desc
+	+path             -> path asc
+	path.asc          -> path asc
+	path.desc         -> path desc
+	path.nullsfirst   -> path nulls first
+	path.nullslast    -> path nulls last
+	-path.nullslast   -> path desc nulls last
+
+Modifiers are case-insensitive, and are recognized only at the end of the
+path. Conflicting modifiers, such as in "-path.asc", cause a parse error. When
+decoding URL queries, keep in mind that "+" typically decodes to a space. For
+repeated query parameters, join the values with commas. Example:
+
+	?order=-createdAt,name.asc.nullslast
+
+The resulting paths are converted to DB column paths in exactly the same way
+as in `.ParseSlice`, consulting `.Type`, `.Filter` and `.Lax`.
+*/
+func (self *ParserOrds) ParseText(src string) error {
+	return OrdsParser{&self.Ords, self.ParseOpt}.ParseText(src)
+}
+
+/*
+Implement `encoding.TextMarshaler`, encoding the orderings in client
+vocabulary, in the URL-style format supported by `.ParseText`, such as
+"-createdAt,name.asc.nullslast". This is the inverse of `.UnmarshalText`,
+useful for generating links such as "next page". See the method `.Strings` for
+more docs.
+*/
+func (self ParserOrds) MarshalText() ([]byte, error) {
+	return OrdsParser{&self.Ords, self.ParseOpt}.MarshalText()
+}
+
+/*
+Converts the orderings back to client vocabulary: strings in the format
+supported by `.ParseSlice`, using JSON field paths rather than DB column
+paths. The output parses to the same orderings with the same options.
+
+Consults `.Type` to convert DB paths to JSON paths, using only paths allowed by
+`.Filter`. Only column orderings such as `Path`, `Ord` or `OrdAsc`, and named
+orderings registered via `OrdExprer`, can be converted. Other elements, and
+columns without an allowed JSON path, cause an error. Nil elements are ignored.
+Orderings added by `.Default` and `.Tiebreak` are omitted when parsing would
+add them again, which matters when their fields are hidden by `.Filter`.
+Because direction and nulls defaults from "ord.dir" and "ord.nulls" tags are
+applied during parsing, the output may be more explicit than the original
+input.
+
+Unlike this method, JSON encoding of `ParserOrds` uses the promoted method
+`Ords.MarshalJSON`, which encodes the elements as-is. To encode the orderings
+in client vocabulary as JSON, encode the output of this method.
+*/
+func (self ParserOrds) Strings() ([]string, error) {
+	return OrdsParser{&self.Ords, self.ParseOpt}.Strings()
+}
+
+/*
+Returns a `Keyset` for keyset pagination, using the parsed orderings and the
+parser's type. See `Keyset` for details.
+*/
+func (self ParserOrds) Keyset() Keyset {
+	return Keyset{Ords: self.Ords, Type: self.Type}
+}
+
 /*
 Similar to `ParserOrds`, but intended to be transient and stackframe-local,
 rather than included into other types. Usually obtained by calling
@@ -110,12 +217,243 @@ func (self OrdsParser) ParseSlice(src []string) (err error) {
 	return
 }
 
+// Implement `encoding.TextUnmarshaler`. See `(*ParserOrds).ParseText` for docs.
+func (self OrdsParser) UnmarshalText(src []byte) (err error) {
+	defer rec(&err)
+	self.noescape().parseText(bytesToMutableString(src))
+	return
+}
+
+// See `(*ParserOrds).ParseText` for docs.
+func (self OrdsParser) ParseText(src string) (err error) {
+	defer rec(&err)
+	self.noescape().parseText(src)
+	return
+}
+
+// Implement `encoding.TextMarshaler`. See `ParserOrds.MarshalText` for docs.
+func (self OrdsParser) MarshalText() (_ []byte, err error) {
+	defer rec(&err)
+	var buf []byte
+
+	for _, val := range self.clientOrds() {
+		if val == nil {
+			continue
+		}
+
+		if len(buf) > 0 {
+			buf = append(buf, ',')
+		}
+
+		path, ord := self.jsonPath(val)
+		if ord.Dir == DirDesc {
+			buf = append(buf, '-')
+		}
+		buf = append(buf, path...)
+		if ord.Dir == DirAsc {
+			buf = append(buf, `.asc`...)
+		}
+		if ord.Nulls == NullsFirst {
+			buf = append(buf, `.nullsfirst`...)
+		} else if ord.Nulls == NullsLast {
+			buf = append(buf, `.nullslast`...)
+		}
+	}
+	return buf, nil
+}
+
+// See `ParserOrds.Strings` for docs.
+func (self OrdsParser) Strings() (out []string, err error) {
+	defer rec(&err)
+
+	for _, val := range self.clientOrds() {
+		if val == nil {
+			continue
+		}
+		out = append(out, ordString(self.jsonPath(val)))
+	}
+	return
+}
+
+/*
+Returns the orderings which must be encoded to reproduce the current orderings
+when parsing with the same options. Omits the orderings which `.complete`
+would add again: either all of them when they match `.Default`, or the trailing
+tiebreaker.
+*/
+func (self *OrdsParser) clientOrds() Ords {
+	src := *self.Ords
+	if self.Default == `` && self.Tiebreak == `` {
+		return src
+	}
+
+	if self.completesTo(nil, src) {
+		return nil
+	}
+
+	if len(src) > 0 && self.completesTo(src[:len(src)-1], src) {
+		return src[:len(src)-1]
+	}
+	return src
+}
+
+func (self *OrdsParser) completesTo(src, exp Ords) bool {
+	out := append(Ords(nil), src...)
+	par := OrdsParser{&out, self.ParseOpt}
+	par.complete()
+	return r.DeepEqual(out, exp)
+}
+
+/*
+Converts a column ordering or a named ordering to its JSON path, consulting
+`.Type` and `.Filter`. Panics if there's no such path.
+*/
+func (self *OrdsParser) jsonPath(val Expr) (string, Ord) {
+	const while = `converting DB path to JSON identifier path`
+
+	named, ok := val.(Ordering)
+	if ok && named.Using == nil {
+		expr, ok := named.Expr.(namedOrdExpr)
+		if ok {
+			return expr.Name, Ord{Dir: named.Dir, Nulls: named.Nulls}
+		}
+	}
+
+	ord, ok := toOrd(val)
+	if !ok {
+		panic(ErrInvalidInput{Err{
+			while,
+			errf(`unsupported ordering expression of type %v; expected a column ordering such as Path or Ord`, typeNameOf(val)),
+		}})
+	}
+
+	dbPath := strings.Join(ord.Path, `.`)
+	fields := loadStructJsonPathToDbPathFieldValueMap(self.Type)
+
+	for _, path := range loadStructDbPathToJsonPathsMap(self.Type)[dbPath] {
+		if self.filter(fields[path].Field) {
+			return path, ord
+		}
+	}
+
+	panic(ErrUnknownField{Err{
+		while,
+		errf(`no JSON path corresponding to DB path %q in type %v`, dbPath, typeName(self.Type)),
+	}})
+}
+
+// Formats an ordering in the format supported by `OrdsParser.ParseSlice`.
+func ordString(path string, ord Ord) string {
+	buf := []byte(path)
+	buf = ord.Dir.AppendTo(buf)
+	buf = ord.Nulls.AppendTo(buf)
+	return bytesToMutableString(buf)
+}
+
 func (self *OrdsParser) parseSlice(src []string) {
 	self.Zero()
-	self.Grow(countNonEmptyStrings(src))
+	self.reqMax(countNonEmptyStrings(src))
+	self.Grow(countNonEmptyStrings(src) + self.extraLen())
 	for _, val := range src {
 		self.parseAppend(val)
 	}
+	self.complete()
+}
+
+func (self *OrdsParser) parseText(src string) {
+	self.Zero()
+	self.parseTextAppend(src)
+	self.complete()
+}
+
+func (self *OrdsParser) parseTextAppend(src string) {
+	if isOrdBlank(src) {
+		return
+	}
+
+	self.Grow(strings.Count(src, `,`) + 1 + self.extraLen())
+
+	var count int
+	for len(src) > 0 {
+		var val string
+		ind := strings.IndexByte(src, ',')
+		if ind >= 0 {
+			val, src = src[:ind], src[ind+1:]
+		} else {
+			val, src = src, ``
+		}
+
+		if isOrdBlank(val) {
+			continue
+		}
+
+		count++
+		self.reqMax(count)
+
+		path, dir, nulls, ok := parseOrdText(val)
+		if !ok {
+			panic(errInvalidOrdText(val))
+		}
+		self.appendOrd(path, dir, nulls)
+	}
+}
+
+/*
+Applies `.Default` and `.Tiebreak` after parsing the input. Both are trusted
+and always strict: they bypass `.Filter` and `.Lax`.
+*/
+func (self *OrdsParser) complete() {
+	if self.Default == `` && self.Tiebreak == `` {
+		return
+	}
+
+	strict := OrdsParser{self.Ords, ParseOpt{Type: self.Type}}
+
+	if self.IsEmpty() {
+		strict.parseTextAppend(self.Default)
+	}
+
+	if self.Tiebreak != `` && !self.hasPath(self.tiebreakPath()) {
+		strict.appendOrd(self.Tiebreak, DirNone, NullsNone)
+	}
+}
+
+func (self *OrdsParser) tiebreakPath() []string {
+	entry, ok := loadStructJsonPathToNestedDbFieldMap(self.Type)[self.Tiebreak]
+	if !ok {
+		panic(errUnknownField(`resolving ordering tiebreaker`, self.Tiebreak, typeName(self.Type)))
+	}
+	return entry.DbPath
+}
+
+func (self *OrdsParser) hasPath(path []string) bool {
+	for _, val := range *self.Ords {
+		if val == nil {
+			continue
+		}
+		ord, ok := toOrd(val)
+		if ok && equalStrings(ord.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *OrdsParser) reqMax(count int) {
+	if self.Max > 0 && count > self.Max {
+		panic(ErrInvalidInput{Err{
+			`parsing ordering expression`,
+			errf(`too many orderings: expected at most %v, found %v`, self.Max, count),
+		}})
+	}
+}
+
+// Upper bound on the amount of orderings added by `.complete`.
+func (self *OrdsParser) extraLen() int {
+	if self.Tiebreak != `` {
+		return 1
+	}
+	return 0
 }
 
 func (self *OrdsParser) parseAppend(src string) {
@@ -123,19 +461,25 @@ func (self *OrdsParser) parseAppend(src string) {
 		return
 	}
 
-	/**
-	This regexp-based parsing is simple to implement, but extremely inefficient,
-	easily trouncing all our optimizations. TODO rewrite in an efficient manner.
-	*/
-	match := ordReg.FindStringSubmatch(src)
-	if match == nil {
+	path, dir, nulls, ok := parseOrd(src)
+	if !ok {
 		panic(errInvalidOrd(src))
 	}
+	self.appendOrd(path, dir, nulls)
+}
 
+func (self *OrdsParser) appendOrd(pathStr string, dir Dir, nulls Nulls) {
 	typ := self.Type
-	pathStr := match[1]
 	entry, ok := loadStructJsonPathToDbPathFieldValueMap(typ)[pathStr]
 
+	if !ok {
+		expr := loadStructOrdExprs(typ)[pathStr]
+		if expr != nil {
+			self.Add(Ordering{Expr: namedOrdExpr{pathStr, expr}, Dir: dir, Nulls: nulls})
+			return
+		}
+	}
+
 	if !ok || !self.filter(entry.Field) {
 		if self.Lax {
 			return
@@ -143,7 +487,6 @@ func (self *OrdsParser) parseAppend(src string) {
 		panic(errUnknownField(`converting JSON identifier path to DB path`, pathStr, typeName(typ)))
 	}
 
-	dir := strDir(match[2])
 	if dir == DirNone {
 		def := entry.Field.Tag.Get(`ord.dir`)
 		if def != `` {
@@ -151,7 +494,6 @@ func (self *OrdsParser) parseAppend(src string) {
 		}
 	}
 
-	nulls := strNulls(match[3])
 	if nulls == NullsNone {
 		def := entry.Field.Tag.Get(`ord.nulls`)
 		if def != `` {
@@ -214,3 +556,17 @@ var (
 	typOrdDescNullsLast  = r.TypeOf((*OrdDescNullsLast)(nil)).Elem()
 	typPath              = r.TypeOf((*Path)(nil)).Elem()
 )
+
+/*
+Ordering expression registered via `OrdExprer`. Remembers its name, which
+allows to encode the ordering back to client vocabulary.
+*/
+type namedOrdExpr struct {
+	Name string
+	Expr Expr
+}
+
+// Implement the `Expr` interface, making this a sub-expression.
+func (self namedOrdExpr) AppendExpr(text []byte, args []any) ([]byte, []any) {
+	return self.Expr.AppendExpr(text, args)
+}
@@ -0,0 +1,253 @@
+package sqlb
+
+import (
+	l "container/list"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+Interface for caches of parsed `Prep`s, used by `Preparse` and therefore by
+`StrQ`. Implementations must be safe for concurrent use. Built-in
+implementations:
+
+	* `PrepCacheMap`: unbounded, never evicts. This is the default.
+	* `PrepCacheLru`: size-limited, evicts least recently used entries.
+
+Use `SetPrepCache` to replace the cache used by `Preparse`. Custom
+implementations may be useful for integrating with external cache libraries.
+*/
+type PrepCacher interface {
+	Get(src string) (Prep, bool)
+	Set(src string, val Prep)
+}
+
+/*
+Hit and miss statistics of `Preparse`, returned by `PrepCacheStats`. Collected
+only while enabled via `EnablePrepCacheStats`. When caching is disabled, every
+call counts as a miss.
+*/
+type PrepStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+/*
+Replaces the cache used by `Preparse`, returning the previous one. Nil disables
+caching, which means every call to `Preparse` parses its input. The default is
+an unbounded `PrepCacheMap`, which is appropriate when all `StrQ` source
+strings are constant. If any code path builds source strings dynamically, use
+a size-limited cache such as `PrepCacheLru` to avoid unbounded memory growth.
+Safe for concurrent use.
+*/
+func SetPrepCache(val PrepCacher) PrepCacher {
+	prev, _ := prepCacheRef.Swap(prepCacheBox{val}).(prepCacheBox)
+	return prev.val
+}
+
+// Returns the cache currently used by `Preparse`. Nil means caching is disabled.
+func GetPrepCache() PrepCacher { return loadPrepCache() }
+
+/*
+Enables or disables collection of `PrepCacheStats`, returning the previous
+state. Disabled by default, because counting involves atomic updates shared by
+all goroutines on every call to `Preparse`. Disabling doesn't reset the
+current statistics. Safe for concurrent use.
+*/
+func EnablePrepCacheStats(val bool) bool {
+	var next uint32
+	if val {
+		next = 1
+	}
+	return atomic.SwapUint32(&prepCacheStatsOn, next) != 0
+}
+
+/*
+Returns the hit and miss statistics accumulated by `Preparse` while enabled via
+`EnablePrepCacheStats`.
+*/
+func PrepCacheStats() PrepStats {
+	return PrepStats{
+		Hits:   atomic.LoadUint64(&prepCacheHits),
+		Misses: atomic.LoadUint64(&prepCacheMisses),
+	}
+}
+
+// Resets the statistics returned by `PrepCacheStats`.
+func ResetPrepCacheStats() {
+	atomic.StoreUint64(&prepCacheHits, 0)
+	atomic.StoreUint64(&prepCacheMisses, 0)
+}
+
+/*
+Pre-warms the cache used by `Preparse` by parsing each given source string,
+typically at startup, without affecting `PrepCacheStats`. Returns an error if
+any string fails to parse, which allows to detect malformed queries early. A
+nop if caching is disabled.
+*/
+func WarmPrepCache(srcs ...string) (err error) {
+	defer rec(&err)
+
+	cache := loadPrepCache()
+	if cache == nil {
+		return
+	}
+
+	for _, src := range srcs {
+		if _, ok := cache.Get(src); !ok {
+			cache.Set(src, parsePrep(src))
+		}
+	}
+	return
+}
+
+/*
+Unbounded `PrepCacher`, used by `Preparse` by default. Never evicts entries.
+The zero value is ready to use.
+*/
+type PrepCacheMap struct{ sync.Map }
+
+// Implement `PrepCacher`.
+func (self *PrepCacheMap) Get(src string) (Prep, bool) {
+	val, ok := self.Load(src)
+	if !ok {
+		return Prep{}, false
+	}
+	return val.(Prep), true
+}
+
+// Implement `PrepCacher`.
+func (self *PrepCacheMap) Set(src string, val Prep) { self.Store(src, val) }
+
+/*
+Size-limited `PrepCacher` which evicts least recently used entries. Use
+`NewPrepCacheLru` to create one.
+*/
+type PrepCacheLru struct {
+	lock      sync.Mutex
+	size      int
+	list      l.List
+	dict      map[string]*l.Element
+	evictions uint64
+}
+
+type prepCacheEntry struct {
+	src string
+	val Prep
+}
+
+/*
+Creates a `PrepCacheLru` which holds at most the given count of entries. A
+non-positive size is treated as 1.
+*/
+func NewPrepCacheLru(size int) *PrepCacheLru {
+	if size <= 0 {
+		size = 1
+	}
+	return &PrepCacheLru{size: size, dict: make(map[string]*l.Element, size)}
+}
+
+// Implement `PrepCacher`. Marks the entry as recently used.
+func (self *PrepCacheLru) Get(src string) (Prep, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	elem := self.dict[src]
+	if elem == nil {
+		return Prep{}, false
+	}
+	self.list.MoveToFront(elem)
+	return elem.Value.(*prepCacheEntry).val, true
+}
+
+// Implement `PrepCacher`. Evicts the least recently used entry when full.
+func (self *PrepCacheLru) Set(src string, val Prep) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	elem := self.dict[src]
+	if elem != nil {
+		elem.Value.(*prepCacheEntry).val = val
+		self.list.MoveToFront(elem)
+		return
+	}
+
+	for self.list.Len() >= self.size {
+		last := self.list.Back()
+		self.list.Remove(last)
+		delete(self.dict, last.Value.(*prepCacheEntry).src)
+		self.evictions++
+	}
+
+	self.dict[src] = self.list.PushFront(&prepCacheEntry{src, val})
+}
+
+// Returns the current count of entries.
+func (self *PrepCacheLru) Len() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.list.Len()
+}
+
+// Returns the total count of evicted entries.
+func (self *PrepCacheLru) Evictions() uint64 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.evictions
+}
+
+var (
+	prepCacheRef     = newPrepCacheRef(new(PrepCacheMap))
+	prepCacheStatsOn uint32
+	prepCacheHits    uint64
+	prepCacheMisses  uint64
+)
+
+func newPrepCacheRef(val PrepCacher) *atomic.Value {
+	out := new(atomic.Value)
+	out.Store(prepCacheBox{val})
+	return out
+}
+
+// Allows `atomic.Value` to store nil and different concrete types.
+type prepCacheBox struct{ val PrepCacher }
+
+func loadPrepCache() PrepCacher {
+	box, _ := prepCacheRef.Load().(prepCacheBox)
+	return box.val
+}
+
+func preparse(src string) Prep {
+	cache := loadPrepCache()
+	if cache == nil {
+		prepCacheCount(&prepCacheMisses)
+		return parsePrep(src)
+	}
+
+	val, ok := cache.Get(src)
+	if ok {
+		prepCacheCount(&prepCacheHits)
+		return val
+	}
+
+	prepCacheCount(&prepCacheMisses)
+	val = parsePrep(src)
+	cache.Set(src, val)
+	return val
+}
+
+/*
+The flag check is an uncontended atomic load. The counters are updated only
+when stats are enabled, avoiding contention in the default configuration.
+*/
+func prepCacheCount(ptr *uint64) {
+	if atomic.LoadUint32(&prepCacheStatsOn) != 0 {
+		atomic.AddUint64(ptr, 1)
+	}
+}
+
+func parsePrep(src string) Prep {
+	out := Prep{Source: src}
+	out.Parse()
+	return out
+}
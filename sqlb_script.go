@@ -0,0 +1,285 @@
+package sqlb
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Splits the given SQL script, such as a migration file, into individual
+statements. Shortcut for iterating with `Splitter`. Returns an error if the
+script is malformed, for example if it has an unclosed quoted string or block
+comment.
+*/
+func SplitScript(src string) (out []Stmt, err error) {
+	defer rec(&err)
+
+	split := Splitter{Source: src}
+	for {
+		val := split.Next()
+		if val.IsEmpty() {
+			return
+		}
+		out = append(out, val)
+	}
+}
+
+/*
+Splits an SQL script into individual statements separated by ";". Built on
+`Tokenizer`, which means semicolons in quoted strings, quoted identifiers,
+dollar-quoted strings and comments are ignored. Also ignores semicolons in
+"begin ... end" blocks, such as Postgres "begin atomic ... end" function bodies
+or SQLite trigger bodies, tracking "case ... end" and nested blocks inside them.
+Transaction statements such as "begin;" and "begin transaction" don't open a
+block.
+
+Each statement excludes the terminating semicolon and any whitespace or
+comments preceding or following it, while comments inside a statement are
+preserved. Empty statements, for example from ";;", are skipped.
+
+Usage: call `.Next` until it returns an empty `Stmt`. Panics if the script is
+malformed. See `SplitScript` for a shortcut that returns an error instead.
+*/
+type Splitter struct {
+	Source  string
+	tok     Tokenizer
+	pending Token
+	pos     TokenPos
+	started bool
+}
+
+/*
+Returns the next statement if possible. When the splitter reaches the end, this
+returns an empty `Stmt{}`. Call `Stmt.IsEmpty` to detect the end.
+*/
+func (self *Splitter) Next() Stmt {
+	if !self.started {
+		self.tok = Tokenizer{Source: self.Source}
+		self.started = true
+	}
+
+	start, end, depth := -1, -1, 0
+
+	for {
+		tok := self.nextToken()
+		if tok.IsInvalid() {
+			break
+		}
+
+		switch tok.Type {
+		case TokenTypeWhitespace, TokenTypeCommentLine, TokenTypeCommentBlock:
+			continue
+
+		case TokenTypeText:
+			text := tok.Text
+			off := tok.Pos.Offset
+
+			for ind := 0; ind < len(text); {
+				char := text[ind]
+
+				if char == ';' && depth <= 0 {
+					self.setPending(text[ind+1:], off+ind+1)
+					if start >= 0 {
+						return self.stmt(start, end)
+					}
+					ind++
+					continue
+				}
+
+				if start < 0 {
+					start = off + ind
+				}
+
+				if !isScriptWordStart(char) {
+					ind++
+					end = off + ind
+					continue
+				}
+
+				word := headScriptWord(text[ind:])
+				isWord := ind <= 0 || text[ind-1] != '.'
+				ind += len(word)
+				end = off + ind
+
+				if isWord {
+					depth += self.depthDelta(word, text[ind:], depth)
+				}
+			}
+
+		default:
+			if start < 0 {
+				start = tok.Pos.Offset
+			}
+			end = tok.Pos.Offset + len(tok.Text)
+		}
+	}
+
+	if start >= 0 {
+		return self.stmt(start, end)
+	}
+	return Stmt{}
+}
+
+func (self *Splitter) nextToken() Token {
+	val := self.pending
+	if !val.IsInvalid() {
+		self.pending = Token{}
+		return val
+	}
+	return self.tok.Next()
+}
+
+func (self *Splitter) setPending(text string, offset int) {
+	if text == `` {
+		self.pending = Token{}
+		return
+	}
+	self.pending = Token{text, TokenTypeText, TokenPos{Offset: offset}}
+}
+
+func (self *Splitter) stmt(start, end int) Stmt {
+	self.pos = advancePos(self.Source, self.pos, start)
+	return Stmt{self.Source[start:end], self.pos}
+}
+
+/*
+Returns the change in block depth caused by the given word. "rest" is the
+remainder of the current text token following the word, used for lookahead.
+*/
+func (self *Splitter) depthDelta(word, rest string, depth int) int {
+	if strings.EqualFold(word, `begin`) {
+		if isScriptTransactionWord(self.peek(rest)) {
+			return 0
+		}
+		return 1
+	}
+
+	if depth <= 0 {
+		return 0
+	}
+
+	if strings.EqualFold(word, `case`) {
+		return 1
+	}
+
+	if strings.EqualFold(word, `end`) {
+		// Closers of statements such as "if" and "loop", whose openers we don't
+		// track.
+		if isScriptEndModifier(self.peek(rest)) {
+			return 0
+		}
+		return -1
+	}
+	return 0
+}
+
+// See `peekLexeme`.
+func (self *Splitter) peek(rest string) string { return peekLexeme(rest, self.tok) }
+
+/*
+Returns the next significant word or character following the current position,
+skipping whitespace and comments. "rest" is the remainder of the current text
+token. Returns an empty string at the end of the source text. Takes the
+tokenizer by value, which allows lookahead without affecting its state.
+*/
+func peekLexeme(rest string, tok Tokenizer) string {
+	if rest != `` {
+		return headScriptLexeme(rest)
+	}
+
+	for {
+		val := tok.Next()
+		switch val.Type {
+		case TokenTypeInvalid:
+			return ``
+		case TokenTypeWhitespace, TokenTypeCommentLine, TokenTypeCommentBlock:
+			continue
+		case TokenTypeText:
+			return headScriptLexeme(val.Text)
+		default:
+			return val.Text
+		}
+	}
+}
+
+/*
+Represents a single statement in an SQL script, as returned by `Splitter` and
+`SplitScript`. `.Pos` is the position of the statement's first character in the
+script, which allows to report errors in terms of the source file.
+
+Implements `Expr`, appending `.Text` as-is, without parameter substitution. To
+substitute named or ordinal parameters, use `.Prep` or `StrQ{stmt.Text, args}`.
+*/
+type Stmt struct {
+	Text string
+	Pos  TokenPos
+}
+
+// True if the statement has no text. Used to detect the end of iteration when
+// calling `(*Splitter).Next`.
+func (self Stmt) IsEmpty() bool { return self.Text == `` }
+
+/*
+Returns a parsed `Prep` for the statement's text, suitable for named-parameter
+substitution via `.AppendParamExpr`. Unlike `Preparse`, this doesn't cache the
+result, because script statements are typically executed once.
+*/
+func (self Stmt) Prep() Prep { return parsePrep(self.Text) }
+
+// Implement the `Expr` interface, making this a sub-expression.
+func (self Stmt) AppendExpr(text []byte, args []any) ([]byte, []any) {
+	return Str(self.Text).AppendExpr(text, args)
+}
+
+// Implement the `AppenderTo` interface, sometimes allowing more efficient text
+// encoding.
+func (self Stmt) AppendTo(text []byte) []byte { return Str(self.Text).AppendTo(text) }
+
+// Implement the `fmt.Stringer` interface for debug purposes.
+func (self Stmt) String() string { return self.Text }
+
+func isScriptWordStart(char byte) bool {
+	return charsetIdentStart.has(char) || char >= utf8.RuneSelf
+}
+
+func isScriptWordChar(char byte) bool {
+	return charsetIdent.has(char) || char == '$' || char >= utf8.RuneSelf
+}
+
+func headScriptWord(src string) string {
+	for ind := 0; ind < len(src); ind++ {
+		if !isScriptWordChar(src[ind]) {
+			return src[:ind]
+		}
+	}
+	return src
+}
+
+func headScriptLexeme(src string) string {
+	if src == `` {
+		return ``
+	}
+	if isScriptWordStart(src[0]) {
+		return headScriptWord(src)
+	}
+	return src[:1]
+}
+
+func isScriptTransactionWord(val string) bool {
+	return val == `` || val == `;` || equalFoldAny(
+		val, `transaction`, `work`, `isolation`, `read`, `deferred`, `immediate`, `exclusive`,
+	)
+}
+
+func isScriptEndModifier(val string) bool {
+	return equalFoldAny(val, `if`, `loop`, `while`, `repeat`, `for`)
+}
+
+func equalFoldAny(val string, opts ...string) bool {
+	for _, opt := range opts {
+		if strings.EqualFold(val, opt) {
+			return true
+		}
+	}
+	return false
+}
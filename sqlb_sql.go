@@ -0,0 +1,83 @@
+package sqlb
+
+import (
+	"context"
+	"database/sql"
+)
+
+/*
+Interface satisfied by `*sql.DB`, `*sql.Tx`, and `*sql.Conn`, used by the
+execution helpers `Exec`, `Query`, `QueryRow`, `Exists`, and `Count`.
+*/
+type Db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+/*
+Renders the expression and executes it via `Db.ExecContext`. Panics during
+rendering, such as `ErrMissingArgument`, are returned as errors.
+*/
+func Exec(ctx context.Context, db Db, expr Expr) (sql.Result, error) {
+	text, args, err := reifyCatch(expr)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecContext(ctx, text, args...)
+}
+
+/*
+Renders the expression and executes it via `Db.QueryContext`. Panics during
+rendering, such as `ErrMissingArgument`, are returned as errors. The caller
+must close the resulting rows.
+*/
+func Query(ctx context.Context, db Db, expr Expr) (*sql.Rows, error) {
+	text, args, err := reifyCatch(expr)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryContext(ctx, text, args...)
+}
+
+/*
+Renders the expression, executes it via `Db.QueryRowContext`, and scans the
+first row into the given outputs. Panics during rendering, such as
+`ErrMissingArgument`, are returned as errors. Returns `sql.ErrNoRows` if there
+are no rows, just like `(*sql.Row).Scan`.
+*/
+func QueryRow(ctx context.Context, db Db, expr Expr, out ...any) error {
+	text, args, err := reifyCatch(expr)
+	if err != nil {
+		return err
+	}
+	return db.QueryRowContext(ctx, text, args...).Scan(out...)
+}
+
+/*
+Returns true if the given query, such as a "select" statement, returns at least
+one row. Wraps the query in "select exists(...)", and doesn't fetch any rows.
+*/
+func Exists(ctx context.Context, db Db, expr Expr) (out bool, err error) {
+	err = QueryRow(ctx, db, Wrap{`select exists(`, expr, `)`}, &out)
+	return
+}
+
+/*
+Returns the count of rows returned by the given query, such as a "select"
+statement. Uses `SelectCount`, and doesn't fetch any rows.
+*/
+func Count(ctx context.Context, db Db, expr Expr) (out int64, err error) {
+	err = QueryRow(ctx, db, SelectCount{expr}, &out)
+	return
+}
+
+func reifyCatch(expr Expr) (string, []any, error) {
+	var bui Bui
+	err := bui.CatchExprs(expr)
+	if err != nil {
+		return ``, nil, err
+	}
+	text, args := bui.Reify()
+	return text, args, nil
+}
@@ -0,0 +1,190 @@
+package sqlb
+
+import r "reflect"
+
+/*
+Statically typed variant of `StrQ` with `StructDict`. The type parameter must
+be a struct type whose public fields provide arguments for named parameters
+such as ":name". Field names are used as-is, just like in `StructDict`. Fields
+of embedded structs are supported. Ordinal parameters are not supported.
+
+Unlike `StrQ`, which detects missing or unused arguments only when rendering,
+`NewTemplate` validates the query once, when constructing the template: every
+named parameter must have a corresponding field, and every field must be used
+by at least one parameter. Rendering, via `(Template).Q`, doesn't need to look
+up fields by name or validate unused arguments, and is therefore considerably
+faster. Usage:
+
+	type UserArgs struct {
+		Id   int64
+		Name string
+	}
+
+	var userUpdate = s.NewTemplate[UserArgs](
+		`update users set name = :Name where id = :Id`,
+	)
+
+	func updateUser(id int64, name string) s.Expr {
+		return userUpdate.Q(UserArgs{id, name})
+	}
+
+Templates are meant to be constructed once and stored in global variables,
+which causes any mismatch between the query and the argument type to be
+detected at program startup. Safe for concurrent use.
+*/
+type Template[A any] struct {
+	Prep   Prep
+	parts  []templatePart
+	fields [][]int
+}
+
+/*
+Either a chunk of query text, or a reference to a field in `Template.fields`.
+Parts with a non-negative field index represent named parameters.
+*/
+type templatePart struct {
+	text  string
+	field int
+}
+
+/*
+Parses the given query, validates its named parameters against the fields of
+the type parameter, and returns a `Template` ready for rendering. Panics if
+the query is malformed, uses ordinal parameters, uses a named parameter
+without a corresponding field, or doesn't use some field.
+*/
+func NewTemplate[A any](src string) Template[A] {
+	var out Template[A]
+	out.init(src)
+	return out
+}
+
+/*
+Returns an expression which renders the template with the given arguments.
+Equivalent to `StrQ{src, StructDict{reflect.ValueOf(args)}}`, but faster.
+*/
+func (self Template[A]) Q(args A) TemplateQ[A] { return TemplateQ[A]{self, args} }
+
+/*
+Renders the template with the given arguments, appending to the given text and
+args. Parameters which occur more than once are rendered as the same ordinal
+parameter, with only one argument. Arguments implementing `Expr` are rendered
+as sub-expressions at each occurrence, just like in `StrQ`.
+*/
+func (self Template[A]) AppendArgs(text []byte, args []any, val A) ([]byte, []any) {
+	bui := Bui{text, args}
+	bui.Grow(len(self.Prep.Source), len(self.fields))
+
+	src := r.ValueOf(&val).Elem()
+	ords := make([]OrdinalParam, len(self.fields))
+
+	for _, part := range self.parts {
+		if part.field < 0 {
+			bui.Text = append(bui.Text, part.text...)
+			continue
+		}
+
+		ord := ords[part.field]
+		if ord > 0 {
+			bui.OrphanParam(ord)
+			continue
+		}
+
+		arg := src.FieldByIndex(self.fields[part.field]).Interface()
+		impl, _ := arg.(Expr)
+		if impl != nil {
+			bui.Expr(impl)
+			continue
+		}
+
+		ord = bui.OrphanArg(arg)
+		bui.OrphanParam(ord)
+		ords[part.field] = ord
+	}
+
+	return bui.Get()
+}
+
+// Implement the `fmt.Stringer` interface for debug purposes.
+func (self Template[A]) String() string { return self.Prep.Source }
+
+func (self *Template[A]) init(src string) {
+	typ := r.TypeOf((*A)(nil)).Elem()
+	reqStructType(`preparing template`, typ)
+
+	self.Prep = parsePrep(src)
+	indexes := map[string]int{}
+
+	for _, tok := range self.Prep.Tokens {
+		switch tok.Type {
+		case TokenTypeOrdinalParam:
+			panic(errTemplateOrdinal(tok.ParseOrdinalParam(), typ, src, tok.Pos))
+
+		case TokenTypeNamedParam:
+			/**
+			Struct fields can't contain dots. Like in `StrQ`, a dotted path such
+			as ":Alias.col" refers to the head field, followed by literal text.
+			*/
+			head, rest := tok.ParseNamedParam().SplitPath()
+			key := head.Key()
+
+			ind, ok := indexes[key]
+			if !ok {
+				path, ok := loadStructPathMap(typ)[key]
+				if !ok || path.FieldIndex == nil {
+					panic(errTemplateMissingField(tok.ParseNamedParam(), typ, src, tok.Pos))
+				}
+
+				ind = len(self.fields)
+				indexes[key] = ind
+				self.fields = append(self.fields, path.FieldIndex)
+			}
+			self.parts = append(self.parts, templatePart{field: ind})
+			if rest != `` {
+				self.parts = append(self.parts, templatePart{text: rest, field: -1})
+			}
+
+		default:
+			self.parts = append(self.parts, templatePart{text: tok.Text, field: -1})
+		}
+	}
+
+	for _, path := range loadStructPaths(typ) {
+		if path.FieldIndex == nil || isTemplateFieldEmbedded(typ, path.FieldIndex) {
+			continue
+		}
+		if _, ok := indexes[path.Name]; !ok {
+			panic(errTemplateUnusedField(path.Name, typ))
+		}
+	}
+}
+
+/*
+Embedded structs are containers of other fields, which are validated
+individually, and don't need to be referenced by parameters.
+*/
+func isTemplateFieldEmbedded(typ r.Type, index []int) bool {
+	field := typ.FieldByIndex(index)
+	return field.Anonymous && typeDeref(field.Type).Kind() == r.Struct
+}
+
+/*
+Expression returned by `(Template).Q`, which renders the template with the
+given arguments. Implements `Expr`.
+*/
+type TemplateQ[A any] struct {
+	Template Template[A]
+	Args     A
+}
+
+// Implement the `Expr` interface, making this a sub-expression.
+func (self TemplateQ[A]) AppendExpr(text []byte, args []any) ([]byte, []any) {
+	return self.Template.AppendArgs(text, args, self.Args)
+}
+
+// Implement the `AppenderTo` interface, sometimes allowing more efficient text
+// encoding.
+func (self TemplateQ[A]) AppendTo(text []byte) []byte { return exprAppend(self, text) }
+
+// Implement the `fmt.Stringer` interface for debug purposes.
+func (self TemplateQ[A]) String() string { return exprString(self) }
@@ -17,22 +17,22 @@ Goals:
 	* Correctly parse whitespace, comments, quoted strings and identifiers,
 	  ordinal parameters, named parameters.
 
+	* Support Postgres-specific constructs which may contain text resembling
+	  parameters: dollar-quoted strings such as "$$...$$" or "$tag$...$tag$",
+	  escape strings such as "E'\''", and nested block comments.
+
 	* Decently fast and allocation-free tokenization.
 
 Non-goals:
 
 	* Full SQL parser.
-
-Notable limitations:
-
-	* No special support for dollar-quoted strings, which are rarely if ever used
-	  in dynamically-generated queries.
 */
 type Tokenizer struct {
 	Source    string
 	Transform func(Token) Token
 	cursor    int
 	next      Token
+	pos       TokenPos
 }
 
 /*
@@ -71,6 +71,9 @@ func (self *Tokenizer) nextToken() Token {
 		if self.maybeWhitespace(); self.cursor > mid {
 			return self.choose(start, mid, TokenTypeWhitespace)
 		}
+		if self.maybeQuotedEscape(); self.cursor > mid {
+			return self.choose(start, mid, TokenTypeQuotedEscape)
+		}
 		if self.maybeQuotedSingle(); self.cursor > mid {
 			return self.choose(start, mid, TokenTypeQuotedSingle)
 		}
@@ -89,6 +92,9 @@ func (self *Tokenizer) nextToken() Token {
 		if self.maybeDoubleColon(); self.cursor > mid {
 			return self.choose(start, mid, TokenTypeDoubleColon)
 		}
+		if self.maybeQuotedDollar(); self.cursor > mid {
+			return self.choose(start, mid, TokenTypeQuotedDollar)
+		}
 		if self.maybeOrdinalParam(); self.cursor > mid {
 			return self.choose(start, mid, TokenTypeOrdinalParam)
 		}
@@ -99,18 +105,28 @@ func (self *Tokenizer) nextToken() Token {
 	}
 
 	if self.cursor > start {
-		return Token{self.from(start), TokenTypeText}
+		return Token{self.from(start), TokenTypeText, self.posAt(start)}
 	}
 	return Token{}
 }
 
 func (self *Tokenizer) choose(start, mid int, typ TokenType) Token {
-	tok := Token{self.from(mid), typ}
 	if mid > start {
-		self.setNext(tok)
-		return Token{self.Source[start:mid], TokenTypeText}
+		out := Token{self.Source[start:mid], TokenTypeText, self.posAt(start)}
+		self.setNext(Token{self.from(mid), typ, self.posAt(mid)})
+		return out
 	}
-	return tok
+	return Token{self.from(mid), typ, self.posAt(mid)}
+}
+
+/*
+Returns the position of the given byte offset, which must not precede the offset
+of any previously returned position. Scans only the text between the last
+position and the new offset, keeping the cost of position tracking linear.
+*/
+func (self *Tokenizer) posAt(offset int) TokenPos {
+	self.pos = advancePos(self.Source, self.pos, offset)
+	return self.pos
 }
 
 func (self *Tokenizer) setNext(val Token) {
@@ -152,9 +168,113 @@ func (self *Tokenizer) maybeCommentLine() {
 	}
 }
 
-// TODO support nested block comments, which are valid in SQL.
+/*
+Postgres escape string constant such as "E'one\'two'". Unlike in regular
+strings, backslash escapes the next character, including a quote. Doubled
+quotes are also supported. Must not be preceded by an identifier character,
+which would make "E" part of that identifier.
+*/
+func (self *Tokenizer) maybeQuotedEscape() {
+	if self.afterIdent() || !self.hasQuotedEscapePrefix() {
+		return
+	}
+	self.skipBytes(2)
+
+	for self.more() {
+		char := self.headByte()
+
+		if char == escapeBackslash {
+			self.skipBytes(1)
+			if self.more() {
+				self.skipChar()
+			}
+			continue
+		}
+
+		if self.skippedByte(quoteSingle) {
+			if self.more() && self.skippedByte(quoteSingle) {
+				continue
+			}
+			return
+		}
+
+		self.skipChar()
+	}
+
+	panic(ErrUnexpectedEOF{Err{
+		`parsing SQL`,
+		fmt.Errorf(`expected closing %q, got unexpected %w`, rune(quoteSingle), io.EOF),
+	}})
+}
+
+func (self *Tokenizer) hasQuotedEscapePrefix() bool {
+	rest := self.rest()
+	return len(rest) >= 2 &&
+		(rest[0] == 'E' || rest[0] == 'e') &&
+		rest[1] == quoteSingle
+}
+
+/*
+Postgres dollar-quoted string such as "$$one$$" or "$tag$one$tag$". The tag is
+optional and follows the rules of unquoted identifiers, except that it can't
+contain "$". Because the tag can't start with a digit, this never conflicts
+with ordinal parameters such as "$1". Must not be preceded by an identifier
+character, because "$" may be part of an identifier.
+*/
+func (self *Tokenizer) maybeQuotedDollar() {
+	if self.afterIdent() {
+		return
+	}
+
+	start := self.cursor
+	if !self.skippedByte(ordinalParamPrefix) {
+		return
+	}
+	if self.more() {
+		self.maybeIdent()
+	}
+	if !self.more() || !self.skippedByte(ordinalParamPrefix) {
+		self.cursor = start
+		return
+	}
+
+	delim := self.from(start)
+	ind := strings.Index(self.rest(), delim)
+	if ind < 0 {
+		panic(ErrUnexpectedEOF{Err{
+			`parsing SQL`,
+			fmt.Errorf(`expected closing %q, got unexpected %w`, delim, io.EOF),
+		}})
+	}
+	self.skipBytes(ind + len(delim))
+}
+
+// Supports nested block comments, which are valid in Postgres.
 func (self *Tokenizer) maybeCommentBlock() {
-	self.maybeStringBetween(commentBlockPrefix, commentBlockSuffix)
+	if !self.skippedString(commentBlockPrefix) {
+		return
+	}
+
+	depth := 1
+	for self.more() {
+		if self.skippedString(commentBlockPrefix) {
+			depth++
+			continue
+		}
+		if self.skippedString(commentBlockSuffix) {
+			depth--
+			if depth <= 0 {
+				return
+			}
+			continue
+		}
+		self.skipChar()
+	}
+
+	panic(ErrUnexpectedEOF{Err{
+		`parsing SQL`,
+		fmt.Errorf(`expected closing %q, got unexpected %w`, commentBlockSuffix, io.EOF),
+	}})
 }
 
 func (self *Tokenizer) maybeDoubleColon() {
@@ -171,6 +291,12 @@ func (self *Tokenizer) maybeOrdinalParam() {
 	}
 }
 
+/*
+Named parameters may contain dotted paths such as ":one.two", which are
+resolved by `PathDict`. For other dictionaries, a missing path falls back on its
+head, such as ":one", followed by text. A dot is included only when followed by
+another identifier.
+*/
 func (self *Tokenizer) maybeNamedParam() {
 	start := self.cursor
 	if !self.skippedByte(namedParamPrefix) {
@@ -178,6 +304,14 @@ func (self *Tokenizer) maybeNamedParam() {
 	}
 	if !self.skippedIdent() {
 		self.cursor = start
+		return
+	}
+
+	for self.cursor+1 < len(self.Source) &&
+		self.Source[self.cursor] == '.' &&
+		charsetIdentStart.has(self.Source[self.cursor+1]) {
+		self.skipBytes(1)
+		self.maybeIdent()
 	}
 }
 
@@ -268,6 +402,11 @@ func (self *Tokenizer) maybeStringBetweenBytes(prefix, suffix byte) {
 	}})
 }
 
+// True if the previous byte is an identifier character.
+func (self *Tokenizer) afterIdent() bool {
+	return self.cursor > 0 && charsetIdent.has(self.Source[self.cursor-1])
+}
+
 func (self *Tokenizer) skipBytes(val int) {
 	self.cursor += val
 }
@@ -289,7 +428,7 @@ func (self *Tokenizer) headByte() byte {
 }
 
 func (self *Tokenizer) skippedByte(val byte) bool {
-	if self.headByte() == val {
+	if self.more() && self.headByte() == val {
 		self.skipBytes(1)
 		return true
 	}
@@ -297,7 +436,7 @@ func (self *Tokenizer) skippedByte(val byte) bool {
 }
 
 func (self *Tokenizer) skippedByteFromCharset(val *charset) bool {
-	if val.has(self.headByte()) {
+	if self.more() && val.has(self.headByte()) {
 		self.skipBytes(1)
 		return true
 	}
@@ -324,15 +463,68 @@ const (
 	TokenTypeDoubleColon
 	TokenTypeOrdinalParam
 	TokenTypeNamedParam
+	TokenTypeQuotedDollar
+	TokenTypeQuotedEscape
 )
 
 // Part of `Token`.
 type TokenType byte
 
-// Represents an arbitrary chunk of SQL text parsed by `Tokenizer`.
+/*
+Represents an arbitrary chunk of SQL text parsed by `Tokenizer`. `.Pos` is the
+position of the token's first character in the source text.
+*/
 type Token struct {
 	Text string
 	Type TokenType
+	Pos  TokenPos
+}
+
+/*
+Position of a `Token` in the source text. `.Offset` is a 0-based byte offset.
+`.Line` and `.Col` are 1-based; columns are counted in characters (runes) rather
+than bytes. The line terminators "\n", "\r\n" and "\r" are all supported. A
+zero value indicates an unknown position, for example for tokens constructed
+manually.
+*/
+type TokenPos struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+// True if the position is known. See `TokenPos`.
+func (self TokenPos) IsValid() bool { return self.Line > 0 }
+
+// Implement `fmt.Stringer` for debug purposes and error messages.
+func (self TokenPos) String() string {
+	if !self.IsValid() {
+		return `unknown position`
+	}
+	return fmt.Sprintf(`line %v, column %v`, self.Line, self.Col)
+}
+
+/*
+Advances the given position in the given source text up to the given byte
+offset. A zero position is treated as the start of the text.
+*/
+func advancePos(src string, pos TokenPos, offset int) TokenPos {
+	if !pos.IsValid() {
+		pos = TokenPos{Line: 1, Col: 1}
+	}
+
+	for pos.Offset < offset {
+		char, size := utf8.DecodeRuneInString(src[pos.Offset:])
+		pos.Offset += size
+
+		if char == '\n' || (char == '\r' && !strings.HasPrefix(src[pos.Offset:], "\n")) {
+			pos.Line++
+			pos.Col = 1
+		} else {
+			pos.Col++
+		}
+	}
+	return pos
 }
 
 /*
@@ -0,0 +1,209 @@
+package sqlb
+
+import (
+	"errors"
+	"io"
+)
+
+/*
+Variant of `Tokenizer` that reads SQL from an `io.Reader` instead of an
+in-memory string, producing the same stream of tokens with the same types and
+positions. Useful for large dump files and generated scripts.
+
+Memory usage is bounded by the chunk size and the size of the largest token,
+rather than the size of the input: text that has already been tokenized is
+discarded. Since a single token such as a huge string literal must still be
+kept in memory in its entirety, `.MaxTokenSize` can be used to limit it.
+Options:
+
+	* `.ChunkSize` is the minimum buffer size used for reading. Defaults to 4096.
+	* `.MaxTokenSize` is the maximum size of a single token in bytes. Exceeding
+	  it produces an error. Zero means no limit.
+
+Unlike `Tokenizer.Next`, `.Next` returns errors instead of panicking, because
+reading may fail for reasons unrelated to the SQL text.
+*/
+type ReaderTokenizer struct {
+	Reader       io.Reader
+	Transform    func(Token) Token
+	ChunkSize    int
+	MaxTokenSize int
+	buf          []byte
+	cursor       int
+	pos          TokenPos
+	eof          bool
+}
+
+/*
+Returns the next token if possible. When the tokenizer reaches the end, this
+returns an empty `Token{}` and a nil error. Call `Token.IsInvalid` to detect
+the end.
+*/
+func (self *ReaderTokenizer) Next() (_ Token, err error) {
+	defer rec(&err)
+
+	for {
+		token := self.nextToken()
+		if token.IsInvalid() {
+			return Token{}, nil
+		}
+
+		if self.Transform != nil {
+			token = self.Transform(token)
+			if token.IsInvalid() {
+				continue
+			}
+		}
+
+		return token, nil
+	}
+}
+
+func (self *ReaderTokenizer) nextToken() Token {
+	for {
+		if self.cursor < len(self.buf) {
+			tok, ok := self.scan()
+			if ok {
+				// Reads may complete a token larger than the limit at once.
+				self.reqTokenSize(len(tok.Text))
+				return self.emit(tok)
+			}
+		} else if self.eof {
+			return Token{}
+		}
+		self.read()
+	}
+}
+
+/*
+Attempts to tokenize the buffered text. The result is incomplete, and more
+text must be read, when the token reaches the end of the buffer or when the
+buffer ends in the middle of a quoted string or a comment. At the end of the
+input, every result is final, and errors are propagated.
+*/
+func (self *ReaderTokenizer) scan() (out Token, ok bool) {
+	defer func() {
+		if self.eof {
+			return
+		}
+		val := recover()
+		if val == nil {
+			return
+		}
+		if _, is := val.(ErrUnexpectedEOF); is {
+			ok = false
+			return
+		}
+		panic(val)
+	}()
+
+	/**
+	The tokenizer starts at the cursor, while having access to the preceding
+	byte, which is needed for some lookbehind checks. Presetting the offset of
+	its position avoids redundantly scanning the preceding text; we track
+	positions separately.
+	*/
+	tok := Tokenizer{
+		Source: bytesToMutableString(self.buf),
+		cursor: self.cursor,
+		pos:    TokenPos{Offset: self.cursor, Line: 1, Col: 1},
+	}
+
+	out = tok.nextToken()
+	end := self.cursor + len(out.Text)
+
+	/**
+	A named parameter followed by "." may continue with a dotted path, which
+	requires one more byte of lookahead. Other tokens don't need it.
+	*/
+	if out.Type == TokenTypeNamedParam {
+		end++
+	}
+	return out, self.eof || end < len(self.buf)
+}
+
+func (self *ReaderTokenizer) emit(tok Token) Token {
+	if !self.pos.IsValid() {
+		self.pos = TokenPos{Line: 1, Col: 1}
+	}
+
+	end := self.cursor + len(tok.Text)
+	text := string(self.buf[self.cursor:end])
+	pos := self.pos
+
+	next := advancePos(text, TokenPos{Line: pos.Line, Col: pos.Col}, len(text))
+	next.Offset += pos.Offset
+
+	self.pos = next
+	self.cursor = end
+	return Token{text, tok.Type, pos}
+}
+
+func (self *ReaderTokenizer) read() {
+	// Discard tokenized text, but retain one byte for lookbehind.
+	if drop := self.cursor - 1; drop > 0 {
+		self.buf = self.buf[:copy(self.buf, self.buf[drop:])]
+		self.cursor -= drop
+	}
+
+	self.reqTokenSize(len(self.buf) - self.cursor)
+
+	if self.Reader == nil {
+		self.eof = true
+		return
+	}
+
+	/**
+	Each failed scan rescans the entire pending token. Reading at least as much
+	as is already pending before rescanning keeps the total cost linear, even
+	when the reader returns short reads, such as one byte at a time. A full
+	buffer is rescanned early, but it grows geometrically, so this happens a
+	logarithmic amount of times.
+	*/
+	pending := len(self.buf) - self.cursor
+	for !self.eof {
+		self.readChunk()
+		if len(self.buf)-self.cursor >= 2*pending || len(self.buf) >= cap(self.buf) {
+			break
+		}
+	}
+}
+
+func (self *ReaderTokenizer) readChunk() {
+	if len(self.buf) >= cap(self.buf) {
+		size := 2 * cap(self.buf)
+		if size < self.chunkSize() {
+			size = self.chunkSize()
+		}
+		buf := make([]byte, len(self.buf), size)
+		copy(buf, self.buf)
+		self.buf = buf
+	}
+
+	size, err := self.Reader.Read(self.buf[len(self.buf):cap(self.buf)])
+	self.buf = self.buf[:len(self.buf)+size]
+
+	if errors.Is(err, io.EOF) {
+		self.eof = true
+		return
+	}
+	if err != nil {
+		panic(Err{`reading SQL`, err})
+	}
+}
+
+func (self *ReaderTokenizer) reqTokenSize(size int) {
+	if self.MaxTokenSize > 0 && size > self.MaxTokenSize {
+		panic(ErrInvalidInput{Err{
+			`parsing SQL`,
+			errf(`token at %v exceeds the limit of %v bytes`, self.pos, self.MaxTokenSize),
+		}})
+	}
+}
+
+func (self *ReaderTokenizer) chunkSize() int {
+	if self.ChunkSize > 0 {
+		return self.ChunkSize
+	}
+	return 4096
+}
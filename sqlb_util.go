@@ -5,7 +5,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	r "reflect"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,6 +23,7 @@ const (
 	quoteSingle        = '\''
 	quoteDouble        = '"'
 	quoteGrave         = '`'
+	escapeBackslash    = '\\'
 
 	byteLen                    = 1
 	expectedStructNestingDepth = 8
@@ -41,6 +42,7 @@ var (
 	charsetWhitespace = new(charset).addSet(charsetSpace).addSet(charsetNewline)
 	charsetDelimStart = new(charset).addSet(charsetWhitespace).addStr(`([{.`)
 	charsetDelimEnd   = new(charset).addSet(charsetWhitespace).addStr(`,}])`)
+	charsetOrdSpace   = new(charset).addStr(" \t\n\f\r")
 )
 
 type charset [256]bool
@@ -68,6 +70,7 @@ func (self *charset) addSet(vals *charset) *charset {
 type structNestedDbField struct {
 	Field  r.StructField
 	DbPath []string
+	Index  []int
 }
 
 type structPath struct {
@@ -173,9 +176,158 @@ func hasDelimSuffix(text string) bool {
 	return len(text) <= 0 || charsetDelimStart.has(text[len(text)-1])
 }
 
-var ordReg = regexp.MustCompile(
-	`^\s*((?:\w+\.)*\w+)(?i)(?:\s+(asc|desc))?(?:\s+nulls\s+(first|last))?\s*$`,
-)
+/*
+Parses an ordering string in the following format, without allocating:
+
+	<path> <asc|desc>? <nulls first | nulls last>?
+
+The path consists of one or more dot-separated identifiers. Keywords are
+case-insensitive. Words are separated by arbitrary whitespace, and the string
+may be padded with whitespace. Returns false if the input doesn't match this
+format.
+*/
+func parseOrd(src string) (path string, dir Dir, nulls Nulls, ok bool) {
+	path, src = ordWord(src)
+	if !isOrdPath(path) {
+		return
+	}
+
+	var word string
+	word, src = ordWord(src)
+
+	dir = strDir(word)
+	if dir != DirNone {
+		word, src = ordWord(src)
+	}
+
+	if word != `` {
+		if !strings.EqualFold(word, `nulls`) {
+			return
+		}
+
+		word, src = ordWord(src)
+		nulls = strNulls(word)
+		if nulls == NullsNone {
+			return
+		}
+
+		word, _ = ordWord(src)
+		if word != `` {
+			return
+		}
+	}
+
+	ok = true
+	return
+}
+
+/*
+Parses an ordering string in the format supported by `parseOrd`, with
+additional support for URL-style shortcuts: a leading "-" or "+" for the
+direction, and trailing dot-separated modifiers "asc", "desc", "nullsfirst",
+"nullslast". Returns false if the input is malformed or the modifiers conflict.
+*/
+func parseOrdText(src string) (path string, dir Dir, nulls Nulls, ok bool) {
+	src = trimOrdSpace(src)
+
+	var signDir Dir
+	if len(src) > 0 && src[0] == '-' {
+		signDir, src = DirDesc, src[1:]
+	} else if len(src) > 0 && src[0] == '+' {
+		signDir, src = DirAsc, src[1:]
+	}
+
+	var modDir Dir
+	var modNulls Nulls
+
+	for {
+		ind := strings.LastIndexByte(src, '.')
+		if ind < 0 {
+			break
+		}
+
+		mod := src[ind+1:]
+		if modDir == DirNone && strDir(mod) != DirNone {
+			modDir = strDir(mod)
+		} else if modNulls == NullsNone && strNullsMod(mod) != NullsNone {
+			modNulls = strNullsMod(mod)
+		} else {
+			break
+		}
+		src = src[:ind]
+	}
+
+	path, dir, nulls, ok = parseOrd(src)
+	if !ok {
+		return
+	}
+
+	for _, val := range [...]Dir{signDir, modDir} {
+		if val == DirNone {
+			continue
+		}
+		if dir != DirNone {
+			ok = false
+			return
+		}
+		dir = val
+	}
+
+	if modNulls != NullsNone {
+		if nulls != NullsNone {
+			ok = false
+			return
+		}
+		nulls = modNulls
+	}
+	return
+}
+
+func trimOrdSpace(src string) string {
+	for len(src) > 0 && charsetOrdSpace.has(src[0]) {
+		src = src[1:]
+	}
+	for len(src) > 0 && charsetOrdSpace.has(src[len(src)-1]) {
+		src = src[:len(src)-1]
+	}
+	return src
+}
+
+func isOrdBlank(src string) bool { return trimOrdSpace(src) == `` }
+
+// Returns the next whitespace-delimited word and the remainder of the input.
+func ordWord(src string) (string, string) {
+	for len(src) > 0 && charsetOrdSpace.has(src[0]) {
+		src = src[1:]
+	}
+
+	ind := 0
+	for ind < len(src) && !charsetOrdSpace.has(src[ind]) {
+		ind++
+	}
+	return src[:ind], src[ind:]
+}
+
+// True if the input is one or more dot-separated non-empty identifiers.
+func isOrdPath(val string) bool {
+	if val == `` {
+		return false
+	}
+
+	prev := byte('.')
+	for ind := 0; ind < len(val); ind++ {
+		char := val[ind]
+		if char == '.' {
+			if prev == '.' {
+				return false
+			}
+		} else if !charsetIdent.has(char) {
+			return false
+		}
+		prev = char
+	}
+	return prev != '.'
+}
 
 func try(err error) {
 	if err != nil {
@@ -257,6 +409,18 @@ func copyStrings(val []string) []string {
 }
 
 // Generics when?
+func equalStrings(one, two []string) bool {
+	if len(one) != len(two) {
+		return false
+	}
+	for ind := range one {
+		if one[ind] != two[ind] {
+			return false
+		}
+	}
+	return true
+}
+
 func copyInts(src []int) []int {
 	if src == nil {
 		return nil
@@ -337,6 +501,12 @@ that any inputs will escape.
 type argTracker struct {
 	Ordinal         map[OrdinalParam]OrdinalParam
 	Named           map[NamedParam]OrdinalParam
+	OrdinalExprs    map[OrdinalParam]string
+	NamedExprs      map[NamedParam]string
+	Paths           map[NamedParam]struct{}
+	Bindings        []ParamBinding
+	ReuseExprs      bool
+	RecordBindings  bool
 	ValidateOrdinal func(int)
 	ValidateNamed   func(string)
 }
@@ -365,6 +535,44 @@ func (self *argTracker) SetNamed(key NamedParam, val OrdinalParam) {
 	self.Named[key] = val
 }
 
+func (self *argTracker) SetOrdinalExpr(key OrdinalParam, val string) {
+	if self.OrdinalExprs == nil {
+		self.OrdinalExprs = make(map[OrdinalParam]string, 16)
+	}
+	self.OrdinalExprs[key] = val
+}
+
+func (self *argTracker) SetNamedExpr(key NamedParam, val string) {
+	if self.NamedExprs == nil {
+		self.NamedExprs = make(map[NamedParam]string, 16)
+	}
+	self.NamedExprs[key] = val
+}
+
+func (self *argTracker) SetPath(key NamedParam) {
+	if self.Paths == nil {
+		self.Paths = make(map[NamedParam]struct{}, 16)
+	}
+	self.Paths[key] = struct{}{}
+}
+
+/*
+Records the binding of a source parameter when requested via
+`.RecordBindings`. Only the first occurrence of each parameter is recorded.
+See `(Prep).AppendParamExprBindings`.
+*/
+func (self *argTracker) SetBinding(val ParamBinding) {
+	if !self.RecordBindings {
+		return
+	}
+	for _, prev := range self.Bindings {
+		if prev.Param == val.Param {
+			return
+		}
+	}
+	self.Bindings = append(self.Bindings, val)
+}
+
 func (self *argTracker) validateOrdinal(key int) {
 	param := OrdinalParam(key).FromIndex()
 	_, ok := self.Ordinal[param]
@@ -373,9 +581,16 @@ func (self *argTracker) validateOrdinal(key int) {
 	}
 }
 
+/*
+A named argument is also considered used when the dictionary resolved a dotted
+path through it, such as ":one.two" for "one". See `PathDict`.
+*/
 func (self *argTracker) validateNamed(key string) {
 	param := NamedParam(key)
 	_, ok := self.Named[param]
+	if !ok {
+		_, ok = self.Paths[param]
+	}
 	if !ok {
 		panic(errUnusedNamed(param))
 	}
@@ -406,6 +621,19 @@ func (self *argTracker) put() {
 	for key := range self.Named {
 		delete(self.Named, key)
 	}
+	for key := range self.OrdinalExprs {
+		delete(self.OrdinalExprs, key)
+	}
+	for key := range self.NamedExprs {
+		delete(self.NamedExprs, key)
+	}
+	for key := range self.Paths {
+		delete(self.Paths, key)
+	}
+	// Returned to the caller, so the slice must not be reused.
+	self.Bindings = nil
+	self.ReuseExprs = false
+	self.RecordBindings = false
 	argTrackerPool.Put(self)
 }
 
@@ -429,6 +657,17 @@ func strNulls(val string) Nulls {
 	return NullsNone
 }
 
+// Parses the URL-style nulls modifiers "nullsfirst" and "nullslast".
+func strNullsMod(val string) Nulls {
+	if strings.EqualFold(val, `nullsfirst`) {
+		return NullsFirst
+	}
+	if strings.EqualFold(val, `nullslast`) {
+		return NullsLast
+	}
+	return NullsNone
+}
+
 func countNonEmptyStrings(vals []string) (count int) {
 	for _, val := range vals {
 		if val != `` {
@@ -447,12 +686,6 @@ func validateIdent(val string) {
 	}
 }
 
-var prepCache = cacheOf(func(src string) Prep {
-	prep := Prep{Source: src}
-	prep.Parse()
-	return prep
-})
-
 var colsCache = cacheOf(func(typ r.Type) string {
 	typ = typeElem(typ)
 	if isStructType(typ) {
@@ -534,6 +767,59 @@ var structPathMapCache = cacheOf(func(typ r.Type) map[string]structPath {
 	return out
 })
 
+type structNamedFieldsKey struct {
+	Type   r.Type
+	Naming FieldNaming
+}
+
+/*
+Public struct fields named according to a `FieldNaming`, used by `PathDict`.
+`.Names` are in field order, and exclude embedded structs whose fields are
+promoted. For `FieldNamingGo`, methods are not included here.
+*/
+type structNamedFields struct {
+	Names   []string
+	Indexes map[string][]int
+}
+
+func loadStructNamedFields(typ r.Type, naming FieldNaming) map[string][]int {
+	return structNamedFieldsCache.Get(structNamedFieldsKey{typeElem(typ), naming}).Indexes
+}
+
+func loadStructNamedLeaves(typ r.Type, naming FieldNaming) []string {
+	return structNamedFieldsCache.Get(structNamedFieldsKey{typeElem(typ), naming}).Names
+}
+
+var structNamedFieldsCache = cacheOf(func(key structNamedFieldsKey) structNamedFields {
+	out := structNamedFields{Indexes: map[string][]int{}}
+
+	typ := key.Type
+	if typ == nil {
+		return out
+	}
+
+	reqStructType(`scanning named struct fields`, typ)
+
+	var paths []structPath
+	path := make([]int, 0, expectedStructNestingDepth)
+	for ind := range counter(typ.NumField()) {
+		appendStructNamedFields(&paths, &path, typ, ind, key.Naming)
+	}
+
+	// Shallower fields take priority, like promoted fields in Go.
+	for _, val := range paths {
+		prev, ok := out.Indexes[val.Name]
+		if ok && len(prev) <= len(val.FieldIndex) {
+			continue
+		}
+		if !ok {
+			out.Names = append(out.Names, val.Name)
+		}
+		out.Indexes[val.Name] = val.FieldIndex
+	}
+	return out
+})
+
 func loadStructJsonPathToNestedDbFieldMap(typ r.Type) map[string]structNestedDbField {
 	return structJsonPathToNestedDbFieldMapCache.Get(typeElem(typ))
 }
@@ -549,13 +835,27 @@ var structJsonPathToNestedDbFieldMapCache = cacheOf(func(typ r.Type) map[string]
 	buf := map[string]structNestedDbField{}
 	jsonPath := make([]string, 0, expectedStructNestingDepth)
 	dbPath := make([]string, 0, expectedStructNestingDepth)
+	index := make([]int, 0, expectedStructNestingDepth)
 
 	for ind := range counter(typ.NumField()) {
-		addJsonPathsToDbPaths(buf, &jsonPath, &dbPath, typ.Field(ind))
+		addJsonPathsToDbPaths(buf, &jsonPath, &dbPath, &index, typ, ind)
 	}
 	return buf
 })
 
+func loadStructDbPathToNestedDbFieldMap(typ r.Type) map[string]structNestedDbField {
+	return structDbPathToNestedDbFieldMapCache.Get(typeElem(typ))
+}
+
+var structDbPathToNestedDbFieldMapCache = cacheOf(func(typ r.Type) map[string]structNestedDbField {
+	src := loadStructJsonPathToNestedDbFieldMap(typ)
+	out := make(map[string]structNestedDbField, len(src))
+	for _, val := range src {
+		out[strings.Join(val.DbPath, `.`)] = val
+	}
+	return out
+})
+
 func loadStructJsonPathToDbPathFieldValueMap(typ r.Type) map[string]structFieldValue {
 	return structJsonPathToDbPathFieldValueMapCache.Get(typeElem(typ))
 }
@@ -569,6 +869,60 @@ var structJsonPathToDbPathFieldValueMapCache = cacheOf(func(typ r.Type) map[stri
 	return out
 })
 
+/*
+Inverse of `loadStructJsonPathToDbPathFieldValueMap`: maps dot-joined DB paths
+to JSON paths. When several JSON paths correspond to the same DB path, they're
+sorted by preference: shortest first, then lexicographically, for determinism.
+The caller should pick the first path allowed by its filter, if any.
+*/
+func loadStructDbPathToJsonPathsMap(typ r.Type) map[string][]string {
+	return structDbPathToJsonPathsMapCache.Get(typeElem(typ))
+}
+
+var structDbPathToJsonPathsMapCache = cacheOf(func(typ r.Type) map[string][]string {
+	src := loadStructJsonPathToDbPathFieldValueMap(typ)
+	out := make(map[string][]string, len(src))
+
+	for jsonPath, val := range src {
+		dbPath := strings.Join(val.Value.Interface().([]string), `.`)
+		out[dbPath] = append(out[dbPath], jsonPath)
+	}
+
+	for _, paths := range out {
+		sort.Slice(paths, func(one, two int) bool {
+			return len(paths[one]) < len(paths[two]) ||
+				(len(paths[one]) == len(paths[two]) && paths[one] < paths[two])
+		})
+	}
+	return out
+})
+
+func loadStructOrdExprs(typ r.Type) map[string]Expr {
+	return structOrdExprsCache.Get(typeElem(typ))
+}
+
+var structOrdExprsCache = cacheOf(func(typ r.Type) map[string]Expr {
+	if typ == nil {
+		return nil
+	}
+
+	impl, _ := r.New(typ).Interface().(OrdExprer)
+	if impl == nil {
+		return nil
+	}
+
+	out := impl.OrdExprs()
+	for key := range out {
+		if !isOrdPath(key) {
+			panic(ErrInvalidInput{Err{
+				`loading ordering expressions`,
+				errf(`invalid ordering expression name %q in type %v; expected one or more dot-separated identifiers`, key, typeName(typ)),
+			}})
+		}
+	}
+	return out
+})
+
 func appendStructDbFields(buf *[]r.StructField, path *[]int, typ r.Type, index int) {
 	field := typ.Field(index)
 	if !isPublic(field.PkgPath) {
@@ -595,6 +949,55 @@ func appendStructDbFields(buf *[]r.StructField, path *[]int, typ r.Type, index i
 	}
 }
 
+func appendStructNamedFields(buf *[]structPath, path *[]int, typ r.Type, index int, naming FieldNaming) {
+	field := typ.Field(index)
+	if !isPublic(field.PkgPath) {
+		return
+	}
+
+	defer resliceInts(path, len(*path))
+	*path = append(*path, index)
+
+	var name string
+	var tagged bool
+
+	switch naming {
+	case FieldNamingDb:
+		var tag string
+		tag, tagged = field.Tag.Lookup(TagNameDb)
+		name = tagIdent(tag)
+		if tagged && name == `` {
+			return
+		}
+
+	case FieldNamingJson:
+		var tag string
+		tag, tagged = field.Tag.Lookup(TagNameJson)
+		if tag == `-` {
+			return
+		}
+		name = tagIdent(tag)
+	}
+
+	inner := typeDeref(field.Type)
+	if field.Anonymous && inner.Kind() == r.Struct && name == `` {
+		for ind := range counter(inner.NumField()) {
+			appendStructNamedFields(buf, path, inner, ind, naming)
+		}
+		return
+	}
+
+	if name == `` {
+		// Like `loadStructDbFields`, the "db" naming excludes untagged fields.
+		if naming == FieldNamingDb {
+			return
+		}
+		name = field.Name
+	}
+
+	*buf = append(*buf, structPath{Name: name, FieldIndex: copyInts(*path)})
+}
+
 func appendStructFieldPaths(buf *[]structPath, path *[]int, typ r.Type, index int) {
 	field := typ.Field(index)
 	if !isPublic(field.PkgPath) {
@@ -708,6 +1111,43 @@ func typeElem(typ r.Type) r.Type {
 	return typ
 }
 
+// Like `valueDeref`, but also unwraps interfaces.
+func valueDerefAny(val r.Value) r.Value {
+	for val.Kind() == r.Ptr || val.Kind() == r.Interface {
+		if val.IsNil() {
+			return r.Value{}
+		}
+		val = val.Elem()
+	}
+	return val
+}
+
+/*
+Like `reflect.Value.FieldByIndex`, but returns an invalid value instead of
+panicking when encountering a nil embedded pointer.
+*/
+func valueFieldByIndex(val r.Value, index []int) r.Value {
+	for ind, key := range index {
+		if ind > 0 {
+			val = valueDeref(val)
+			if !val.IsValid() {
+				return val
+			}
+		}
+		val = val.Field(key)
+	}
+	return val
+}
+
+// Splits a dotted path such as "one.two.three" into "one" and "two.three".
+func splitPathHead(val string) (string, string) {
+	ind := strings.IndexByte(val, '.')
+	if ind >= 0 {
+		return val[:ind], val[ind+1:]
+	}
+	return val, ``
+}
+
 func valueDeref(val r.Value) r.Value {
 	for val.Kind() == r.Ptr {
 		if val.IsNil() {
@@ -718,6 +1158,33 @@ func valueDeref(val r.Value) r.Value {
 	return val
 }
 
+/*
+Value counterpart of `typeDeref`. Dereferences pointers and unwraps structs
+whose first field is tagged with "role:ref". Returns an invalid value when
+encountering a nil pointer.
+*/
+func valueDerefRef(val r.Value) r.Value {
+	for val.IsValid() {
+		if val.Kind() == r.Ptr {
+			if val.IsNil() {
+				return r.Value{}
+			}
+			val = val.Elem()
+			continue
+		}
+
+		if val.Kind() == r.Struct && val.NumField() > 0 {
+			if val.Type().Field(0).Tag.Get(`role`) == `ref` {
+				val = val.Field(0)
+				continue
+			}
+		}
+
+		break
+	}
+	return val
+}
+
 func typeElemOf(typ any) r.Type {
 	return typeElem(r.TypeOf(typ))
 }
@@ -911,13 +1378,22 @@ func appendFieldCols(buf *[]byte, path *[]string, field r.StructField) {
 }
 
 func addJsonPathsToDbPaths(
-	buf map[string]structNestedDbField, jsonPath *[]string, dbPath *[]string, field r.StructField,
+	buf map[string]structNestedDbField,
+	jsonPath *[]string,
+	dbPath *[]string,
+	index *[]int,
+	typ r.Type,
+	fieldIndex int,
 ) {
+	field := typ.Field(fieldIndex)
 	if !isPublic(field.PkgPath) {
 		return
 	}
 
-	typ := typeDeref(field.Type)
+	defer resliceInts(index, len(*index))
+	*index = append(*index, fieldIndex)
+
+	typ = typeDeref(field.Type)
 	jsonName := FieldJsonName(field)
 	tag, ok := field.Tag.Lookup(TagNameDb)
 	dbName := tagIdent(tag)
@@ -926,7 +1402,7 @@ func addJsonPathsToDbPaths(
 		if !ok {
 			if field.Anonymous && typ.Kind() == r.Struct {
 				for ind := range counter(typ.NumField()) {
-					addJsonPathsToDbPaths(buf, jsonPath, dbPath, typ.Field(ind))
+					addJsonPathsToDbPaths(buf, jsonPath, dbPath, index, typ, ind)
 				}
 			}
 		}
@@ -942,11 +1418,12 @@ func addJsonPathsToDbPaths(
 	buf[strings.Join(*jsonPath, `.`)] = structNestedDbField{
 		Field:  field,
 		DbPath: copyStrings(*dbPath),
+		Index:  copyInts(*index),
 	}
 
 	if isStructType(typ) {
 		for ind := range counter(typ.NumField()) {
-			addJsonPathsToDbPaths(buf, jsonPath, dbPath, typ.Field(ind))
+			addJsonPathsToDbPaths(buf, jsonPath, dbPath, index, typ, ind)
 		}
 	}
 }
@@ -954,7 +1431,8 @@ func addJsonPathsToDbPaths(
 func trimWhitespaceAndComments(val Token) Token {
 	switch val.Type {
 	case TokenTypeWhitespace:
-		return Token{` `, TokenTypeWhitespace}
+		val.Text = ` `
+		return val
 	case TokenTypeCommentLine, TokenTypeCommentBlock:
 		return Token{}
 	default:
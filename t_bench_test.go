@@ -565,6 +565,28 @@ func benchParseOrds() {
 	try(parser.ParseSlice(benchOrderingStrings))
 }
 
+func Benchmark_parse_ord_regexp(b *testing.B) {
+	for range counter(b.N) {
+		for _, val := range benchOrderingStrings {
+			_ = benchParseOrdRegexp(val)
+		}
+	}
+}
+
+//go:noinline
+func benchParseOrdRegexp(src string) []string { return ordReg.FindStringSubmatch(src) }
+
+func Benchmark_parse_ord_handwritten(b *testing.B) {
+	for range counter(b.N) {
+		for _, val := range benchOrderingStrings {
+			_, _, _, _ = benchParseOrdHandwritten(val)
+		}
+	}
+}
+
+//go:noinline
+func benchParseOrdHandwritten(src string) (string, Dir, Nulls, bool) { return parseOrd(src) }
+
 var benchParserOrds = ParserOrds{
 	Ords: make(Ords, 0, len(benchOrderingStrings)),
 	ParseOpt: ParseOpt{
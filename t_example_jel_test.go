@@ -45,3 +45,53 @@ func ExampleJel() {
 	// (($1 or ("external_name" = $2)) and ($3 and (("internal")."internal_time" < $4)))
 	// []interface {}{false, "literal string", true, time.Date(9999, time.January, 1, 0, 0, 0, 0, time.UTC)}
 }
+
+func ExampleJel_Eval() {
+	type Person struct {
+		Name string `json:"name" db:"name"`
+		Age  *int64 `json:"age"  db:"age"`
+	}
+
+	age := int64(20)
+	people := []Person{{`Alice`, &age}, {`Bob`, nil}}
+
+	expr := sqlb.JelFor(Person{})
+	expr.Text = `["or", [">", "age", 18], ["=", "name", ["name", "Bob"]]]`
+
+	for _, person := range people {
+		ok, err := expr.Test(person)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(person.Name, ok)
+	}
+
+	// Output:
+	// Alice true
+	// Bob true
+}
+
+func ExampleJel_ParseSexpr() {
+	type Person struct {
+		Name string `json:"name" db:"name"`
+		Age  *int64 `json:"age"  db:"age"`
+	}
+
+	expr := sqlb.JelFor(Person{})
+
+	err := expr.ParseSexpr(`(and (= name "Alice") (> age 18))`)
+	if err != nil {
+		panic(err)
+	}
+
+	text, args := sqlb.Reify(expr)
+
+	fmt.Println(expr.Text)
+	fmt.Println(string(text))
+	fmt.Printf("%#v\n", args)
+
+	// Output:
+	// ["and",["=","name",["name","Alice"]],[">","age",18]]
+	// (("name" = $1) and ("age" > $2))
+	// []interface {}{"Alice", 18}
+}
@@ -3,6 +3,7 @@ package sqlb_test
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	s "github.com/mitranim/sqlb"
 )
@@ -810,6 +811,193 @@ func ExampleParserOrds_UnmarshalJSON() {
 	// order by "dbCol0" asc, "dbCol1" desc nulls last
 }
 
+func ExampleParserOrds_ParseText() {
+	type SomeStruct struct {
+		Col0 string `json:"jsonField0" db:"dbCol0"`
+		Col1 string `json:"jsonField1" db:"dbCol1"`
+	}
+
+	var par s.ParserOrds
+	par.OrType((*SomeStruct)(nil))
+
+	err := par.ParseText(`-jsonField0,jsonField1.asc.nullslast`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("%#v\n\n", par.Ords)
+	fmt.Println(par.Ords)
+	// Output:
+	// sqlb.Ords{sqlb.OrdDesc{"dbCol0"}, sqlb.OrdAscNullsLast{"dbCol1"}}
+	//
+	// order by "dbCol0" desc, "dbCol1" asc nulls last
+}
+
+func ExampleKeyset() {
+	type Person struct {
+		Id   int64  `json:"id"   db:"id"`
+		Name string `json:"name" db:"name"`
+	}
+
+	var par s.ParserOrds
+	par.OrType((*Person)(nil))
+
+	err := par.ParseSlice([]string{`name asc`, `id desc`})
+	if err != nil {
+		panic(err)
+	}
+
+	keyset := par.Keyset()
+
+	err = keyset.SetLast(Person{Id: 10, Name: `Alice`})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(s.Reify(
+		s.Exprs{
+			s.Select{`persons`, keyset},
+			par.Ords,
+			s.LimitUint(20),
+		},
+	))
+	// Output:
+	// select * from "persons" where (("name" > $1 or "name" is null) or ("name" = $2 and "id" < $3)) order by "name" asc, "id" desc limit 20 [Alice Alice 10]
+}
+
+func ExampleSplitScript() {
+	stmts, err := s.SplitScript(`
+-- Comments between statements are dropped.
+create table persons (id int, name text);
+
+create function person_count() returns bigint
+begin atomic
+	select count(*) from persons;
+end;
+
+insert into persons values (:id, ':name; not a param');
+`)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, stmt := range stmts {
+		fmt.Printf("%v: %q\n", stmt.Pos, stmt.Text)
+	}
+
+	fmt.Println(s.Reify(s.StrQ{stmts[2].Text, s.Dict{`id`: 10}}))
+	// Output:
+	// line 3, column 1: "create table persons (id int, name text)"
+	// line 5, column 1: "create function person_count() returns bigint\nbegin atomic\n\tselect count(*) from persons;\nend"
+	// line 10, column 1: "insert into persons values (:id, ':name; not a param')"
+	// insert into persons values ($1, ':name; not a param') [10]
+}
+
+func ExampleMinify() {
+	text, args := s.Reify(s.StrQ{`
+		-- Find active persons.
+		select * from persons
+		where
+			active
+			and name = :name /* exact match */
+	`, s.Dict{`name`: `Alice`}})
+
+	fmt.Println(s.Minify(text), args)
+	// Output:
+	// select * from persons where active and name = $1 [Alice]
+}
+
+func ExamplePrettify() {
+	text, _ := s.Reify(s.Exprs{
+		s.Select{`persons`, s.Ands{
+			s.Eq{s.Ident(`active`), true},
+			s.Str(`"id" in (select "person_id" from "admins")`),
+		}},
+		s.Ords{s.OrdDesc{`id`}},
+		s.LimitUint(10),
+	})
+
+	fmt.Println(s.Prettify(text))
+	// Output:
+	// select *
+	// from "persons"
+	// where (("active") = $1) and ("id" in (
+	// 	select "person_id"
+	// 	from "admins"
+	// ))
+	// order by "id" desc
+	// limit 10
+}
+
+func ExampleFingerprintOf() {
+	type Row struct {
+		Id   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	one := s.FingerprintOf(s.Exprs{
+		s.Str(`insert into persons`),
+		s.StructsInsertOf(Row{10, `Alice`}),
+	})
+
+	two := s.FingerprintOf(s.Exprs{
+		s.Str(`insert into persons`),
+		s.StructsInsertOf(Row{20, `Bob`}, Row{30, `Carol`}, Row{40, `Dave`}),
+	})
+
+	fmt.Println(one.Text)
+	fmt.Println(one == two)
+	// Output:
+	// insert into persons("id", "name") values(?, ?)
+	// true
+}
+
+func ExampleReifyDebug() {
+	fmt.Println(s.ReifyDebug(s.StrQ{
+		`select * from persons where name = :name and avatar = :avatar and created_at < :time`,
+		s.Dict{
+			`name`:   `O'Brien`,
+			`avatar`: []byte(`hello`),
+			`time`:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}))
+	// Output:
+	// /* sqlb debug: arguments inlined, unsafe for execution */ select * from persons where name = 'O''Brien' and avatar = '\x68656c6c6f' and created_at < '2024-01-02T03:04:05Z'
+}
+
+func ExampleNewTemplate() {
+	type Args struct {
+		Id   int64
+		Name string
+	}
+
+	tpl := s.NewTemplate[Args](
+		`update persons set name = :Name where id = :Id returning id = :Id`,
+	)
+
+	fmt.Println(s.Reify(tpl.Q(Args{10, `Alice`})))
+	// Output:
+	// update persons set name = $1 where id = $2 returning id = $2 [Alice 10]
+}
+
+func ExamplePathDict() {
+	type Filter struct {
+		MinAge int64 `json:"minAge"`
+		MaxAge int64 `json:"maxAge"`
+	}
+
+	type Args struct {
+		Filter Filter `json:"filter"`
+	}
+
+	fmt.Println(s.Reify(s.StrQ{
+		`select * from persons where age between :filter.minAge and :filter.maxAge`,
+		s.PathDict{Args{Filter{18, 65}}, s.FieldNamingJson},
+	}))
+	// Output:
+	// select * from persons where age between $1 and $2 [18 65]
+}
+
 func ExampleLimitUint() {
 	fmt.Println(s.Reify(
 		s.Exprs{s.Select{`some_table`, nil}, s.LimitUint(10)},
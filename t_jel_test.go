@@ -1,6 +1,7 @@
 package sqlb
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -43,3 +44,303 @@ func Test_Jel_Transcode(t *testing.T) {
 		args,
 	)
 }
+
+type JelEvalInternal struct {
+	InternalTime *time.Time `json:"internalTime" db:"internal_time"`
+}
+
+type JelEvalExternal struct {
+	Id       int64            `json:"id"       db:"id"`
+	Name     string           `json:"name"     db:"name"`
+	Nick     *string          `json:"nick"     db:"nick"`
+	Flag     *bool            `json:"flag"     db:"flag"`
+	Tags     []string         `json:"tags"     db:"tags"`
+	Internal JelEvalInternal  `json:"internal" db:"internal"`
+	Ptr      *JelEvalInternal `json:"ptr"      db:"ptr"`
+}
+
+func Test_Jel_Eval(t *testing.T) {
+	nick := `nick`
+	val := JelEvalExternal{
+		Id:       10,
+		Name:     `name`,
+		Nick:     &nick,
+		Tags:     []string{`one`, `two`},
+		Internal: JelEvalInternal{parseTime(`2000-01-01T00:00:00Z`)},
+	}
+
+	test := func(exp any, src string) {
+		t.Helper()
+		jel := Jel{typeElemOf(val), src}
+		eq(t, exp, try1(jel.Eval(val)))
+		eq(t, exp, try1(jel.Eval(&val)))
+	}
+
+	test(true, ``)
+	test(int64(10), `"id"`)
+	test(`name`, `"name"`)
+	test(`nick`, `"nick"`)
+	test(nil, `"flag"`)
+	test(nil, `"ptr.internalTime"`)
+	test(*parseTime(`2000-01-01T00:00:00Z`), `"internal.internalTime"`)
+
+	test(true, `["=", "id", 10]`)
+	test(false, `["=", "id", 20]`)
+	test(true, `["<>", "id", 20]`)
+	test(true, `["<", "id", 20]`)
+	test(false, `[">", "id", 20]`)
+	test(true, `["<=", "id", 10]`)
+	test(true, `[">=", "id", 10]`)
+	test(true, `["=", "name", ["name", "name"]]`)
+	test(true, `["<", "name", ["name", "other"]]`)
+	test(true, `["<", "internal.internalTime", ["internal.internalTime", "9999-01-01T00:00:00Z"]]`)
+	test(false, `[">", "internal.internalTime", ["internal.internalTime", "9999-01-01T00:00:00Z"]]`)
+
+	test(nil, `["=", "flag", true]`)
+	test(nil, `["<>", "flag", true]`)
+	test(nil, `["=", "id", null]`)
+	test(true, `["is distinct from", "flag", true]`)
+	test(false, `["is not distinct from", "flag", true]`)
+	test(true, `["is not distinct from", "flag", null]`)
+	test(false, `["is distinct from", "id", 10]`)
+
+	test(true, `["is null", "flag"]`)
+	test(false, `["is not null", "flag"]`)
+	test(false, `["is null", "id"]`)
+	test(true, `["is unknown", "flag"]`)
+	test(false, `["is not unknown", "flag"]`)
+	test(false, `["is true", "flag"]`)
+	test(true, `["is not true", "flag"]`)
+	test(false, `["is false", "flag"]`)
+	test(true, `["is not false", "flag"]`)
+
+	test(false, `["not", true]`)
+	test(true, `["not", false]`)
+	test(nil, `["not", "flag"]`)
+
+	test(true, `["and", true, true]`)
+	test(false, `["and", true, false]`)
+	test(nil, `["and", true, "flag"]`)
+	test(false, `["and", "flag", false]`)
+	test(true, `["or", false, true]`)
+	test(false, `["or", false, false]`)
+	test(nil, `["or", false, "flag"]`)
+	test(true, `["or", "flag", true]`)
+
+	test(true, `["between", "id", 5, 15]`)
+	test(false, `["between", "id", 15, 25]`)
+	test(nil, `["between", "id", 5, null]`)
+	test(false, `["between", "id", 15, null]`)
+
+	test(true, `["any", ["name", "two"], "tags"]`)
+	test(false, `["any", ["name", "three"], "tags"]`)
+	test(nil, `["any", "flag", "tags"]`)
+	test(true, `["any", ["name", "one"], ["tags", ["one", "two"]]]`)
+	test(false, `["any", "flag", ["tags", []]]`)
+	test(nil, `["any", "name", ["tags", null]]`)
+
+	test(
+		true,
+		`["and",
+			["or", false, ["=", "name", ["name", "name"]]],
+			["and", true, ["<", "internal.internalTime", ["internal.internalTime", "9999-01-01T00:00:00Z"]]]
+		]`,
+	)
+}
+
+func Test_Jel_Eval_invalid(t *testing.T) {
+	var val JelEvalExternal
+
+	test := func(msg, src string, val any) {
+		t.Helper()
+		panics(t, msg, func() {
+			try1(Jel{typeElemOf(JelEvalExternal{}), src}.Eval(val))
+		})
+	}
+
+	test(`expected a value of type sqlb.JelEvalExternal, found nil`, `true`, nil)
+	test(`expected a value of type sqlb.JelEvalExternal, found nil`, `true`, (*JelEvalExternal)(nil))
+	test(`expected a value of type sqlb.JelEvalExternal, found sqlb.Outer`, `true`, Outer{})
+	test(`unexpected dict in input`, `{}`, val)
+	test(`lists must have at least one element, found empty list`, `[]`, val)
+	test(`no DB path corresponding to JSON path "missing"`, `"missing"`, val)
+	test(`no DB path corresponding to JSON path "missing"`, `["missing", 10]`, val)
+	test(`operation "~" is not supported for in-memory evaluation`, `["~", "name", "name"]`, val)
+	test(`operation "@@" is not supported for in-memory evaluation`, `["@@", "name", "name"]`, val)
+	test(`infix operation "=" must have at least 2 arguments, found 1`, `["=", "id"]`, val)
+	test(`prefix operation "not" must have exactly 1 argument, found 2`, `["not", true, false]`, val)
+	test(`operation "between" must have exactly 3 arguments, found 2`, `["between", "id", 10]`, val)
+	test(`operation "<" can't compare values of types string and int64`, `["<", "name", 10]`, val)
+	test(`operation "<" can't compare values of types string and float64`, `["<", "name", 0.5]`, val)
+	test(`expected boolean or null, found string`, `["and", "name", true]`, val)
+	test(`operation "any" expected a list as the second argument, found string`, `["any", "name", "name"]`, val)
+}
+
+type JelEvalNumbers struct {
+	Id    int64    `json:"id"    db:"id"`
+	Big   uint64   `json:"big"   db:"big"`
+	Ratio float64  `json:"ratio" db:"ratio"`
+	Ids   []uint64 `json:"ids"   db:"ids"`
+}
+
+func Test_Jel_Eval_large_numbers(t *testing.T) {
+	val := JelEvalNumbers{Id: 1<<53 + 1, Big: math.MaxUint64, Ratio: 0.5}
+
+	test := func(exp any, src string) {
+		t.Helper()
+		eq(t, exp, try1(Jel{typeElemOf(val), src}.Eval(val)))
+	}
+
+	test(int64(9007199254740993), `"id"`)
+	test(uint64(18446744073709551615), `"big"`)
+	test(int64(9007199254740993), `9007199254740993`)
+	test(uint64(18446744073709551615), `18446744073709551615`)
+
+	test(true, `["=", "id", 9007199254740993]`)
+	test(false, `["=", "id", 9007199254740992]`)
+	test(true, `[">", "id", 9007199254740992]`)
+	test(true, `["=", "id", ["id", 9007199254740993]]`)
+	test(false, `["=", "id", ["id", 9007199254740994]]`)
+
+	test(true, `["=", "big", 18446744073709551615]`)
+	test(false, `["=", "big", 18446744073709551614]`)
+	test(true, `[">", "big", 18446744073709551614]`)
+	test(true, `["=", "big", ["big", 18446744073709551615]]`)
+	test(true, `["any", "big", ["ids", [1, 18446744073709551615]]]`)
+	test(false, `["any", "big", ["ids", [1, 18446744073709551614]]]`)
+	test(true, `["<", "id", "big"]`)
+	test(true, `[">", "big", "id"]`)
+	test(true, `["<", -1, "big"]`)
+
+	test(true, `["<", "ratio", 1]`)
+	test(true, `[">", "ratio", 0]`)
+	test(true, `["=", "ratio", 0.5]`)
+	test(true, `["<", "ratio", "big"]`)
+}
+
+func Test_Jel_Test(t *testing.T) {
+	val := JelEvalExternal{Id: 10}
+	jel := JelFor(val)
+
+	test := func(exp bool, src string) {
+		t.Helper()
+		jel.Text = src
+		eq(t, exp, try1(jel.Test(val)))
+	}
+
+	test(true, ``)
+	test(true, `["=", "id", 10]`)
+	test(false, `["=", "id", 20]`)
+	test(false, `["=", "flag", true]`)
+
+	jel.Text = `"id"`
+	panics(t, `expected boolean or null, found int64`, func() { try1(jel.Test(val)) })
+}
+
+func Test_Jel_Filter(t *testing.T) {
+	type Target struct {
+		Tagged   string `json:"jsonTagged"   db:"db_tagged" jel:""`
+		Untagged string `json:"jsonUntagged" db:"db_untagged"`
+	}
+
+	typ := typeElemOf(Target{})
+	val := Target{`one`, `two`}
+
+	t.Run(`without filter`, func(t *testing.T) {
+		jel := Jel{Type: typ, Text: `["=", "jsonTagged", "jsonUntagged"]`}
+		eq(t, `("db_tagged" = "db_untagged")`, jel.String())
+		eq(t, false, try1(jel.Test(val)))
+	})
+
+	t.Run(`with filter`, func(t *testing.T) {
+		test := func(src string) {
+			t.Helper()
+			jel := JelFiltered{Jel: Jel{typ, src}, Filter: TagFilter(`jel`)}
+
+			panics(t, `no DB path corresponding to JSON path "jsonUntagged" in type sqlb.Target`, func() {
+				_ = jel.String()
+			})
+
+			panics(t, `no DB path corresponding to JSON path "jsonUntagged" in type sqlb.Target`, func() {
+				try1(jel.Eval(val))
+			})
+		}
+
+		test(`"jsonUntagged"`)
+		test(`["=", "jsonTagged", "jsonUntagged"]`)
+		test(`["=", "jsonTagged", ["jsonUntagged", "two"]]`)
+
+		jel := JelFiltered{Jel: Jel{typ, `["=", "jsonTagged", ["jsonTagged", "one"]]`}, Filter: TagFilter(`jel`)}
+		eq(t, R{`("db_tagged" = $1)`, list{`one`}}, reify(jel))
+		eq(t, true, try1(jel.Test(val)))
+	})
+
+	t.Run(`lax`, func(t *testing.T) {
+		test := func(expText string, expArgs list, expEval any, src string) {
+			t.Helper()
+			jel := JelFiltered{Jel: Jel{typ, src}, Filter: TagFilter(`jel`), Lax: true}
+			eq(t, R{expText, expArgs}, reify(jel))
+			eq(t, expEval, try1(jel.Eval(val)))
+		}
+
+		test(`null`, list{}, nil, `"jsonUntagged"`)
+		test(`null`, list{}, nil, `"missing"`)
+		test(`("db_tagged" = null)`, list{}, nil, `["=", "jsonTagged", "jsonUntagged"]`)
+		test(`("db_tagged" = null)`, list{}, nil, `["=", "jsonTagged", ["jsonUntagged", "two"]]`)
+		test(`(null is null)`, list{}, true, `["is null", "missing"]`)
+		test(`("db_tagged" = $1)`, list{`one`}, true, `["=", "jsonTagged", ["jsonTagged", "one"]]`)
+
+		panics(t, `cast into "missing" must have exactly 1 argument, found 2`, func() {
+			_ = JelFiltered{Jel: Jel{typ, `["missing", 1, 2]`}, Lax: true}.String()
+		})
+	})
+}
+
+func Test_Jel_ParseSexpr(t *testing.T) {
+	test := func(expText string, expArgs list, src string) {
+		t.Helper()
+		jel := JelFor(JelEvalExternal{})
+		try(jel.ParseSexpr(src))
+		eq(t, R{expText, expArgs}, reify(jel))
+	}
+
+	test(`true`, list{}, ``)
+	test(`true`, list{}, " \n\t ")
+	test(`"id"`, list{}, `id`)
+	test(`("internal")."internal_time"`, list{}, `internal.internalTime`)
+	test(`$1`, list{true}, `true`)
+	test(`("id" = $1)`, list{float64(10)}, `(= id 10)`)
+	test(`("name" = $1)`, list{`one`}, `(= name "one")`)
+	test(`($1 = "name")`, list{`one`}, `(= "one" name)`)
+	test(`("name" = $1)`, list{"one\ntwo"}, `(= name "one\ntwo")`)
+	test(`("nick" is not null)`, list{}, `(is not null nick)`)
+	test(`("id" is not distinct from $1)`, list{float64(10)}, "(is not\n\tdistinct from id 10)")
+	test(`("id" between $1 and $2)`, list{float64(10), float64(20)}, `(between id 10 20)`)
+	test(`$1`, list{int64(10)}, `(id 10)`)
+	test(`("name" = any ($1))`, list{[]string{`one`, `two`}}, `(any name (tags ["one" "two"]))`)
+
+	test(
+		`(("name" = $1) and ("id" > $2) and ("nick" is not null))`,
+		list{`one`, float64(10)},
+		`(and (= name "one") (> id 10) (is not null nick))`,
+	)
+}
+
+func Test_Jel_ParseSexpr_invalid(t *testing.T) {
+	test := func(msg, src string) {
+		t.Helper()
+		jel := JelFor(JelEvalExternal{})
+		jel.Text = `true`
+
+		panics(t, msg, func() { try(jel.ParseSexpr(src)) })
+		eq(t, `true`, jel.Text)
+	}
+
+	test(`at line 1, column 1: lists must have at least one element, found empty list`, `()`)
+	test(`at line 1, column 2: list must begin with an operation or a field path, found '('`, `(("x"))`)
+	test(`at line 1, column 4: no DB path corresponding to JSON path "missing"`, `(= missing 10)`)
+	test(`at line 3, column 5: no DB path corresponding to JSON path "missing"`, "(and\n\ttrue\n\t(= missing 10))")
+	test(`at line 1, column 4: unable to infer the type of string literal "x"`, `(= "x" "y")`)
+	test(`at line 1, column 10: unexpected ')' after the end of expression`, `(= id 10))`)
+	test(`expected ")", got unexpected end of input`, `(= id 10`)
+}
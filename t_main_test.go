@@ -89,6 +89,14 @@ func (self TrioStruct) GetOne() any   { return self.One }
 func (self TrioStruct) GetTwo() any   { return self.Two }
 func (self TrioStruct) GetThree() any { return self.Three }
 
+// Each call returns a different value, which reveals repeated evaluation.
+type CounterStruct struct{ Count *int }
+
+func (self CounterStruct) GetNext() any {
+	*self.Count++
+	return *self.Count
+}
+
 type list = []any
 
 type Encoder interface {
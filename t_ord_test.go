@@ -1,8 +1,11 @@
 package sqlb
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	r "reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -181,6 +184,164 @@ func Test_ParserOrds_UnmarshalJSON(t *testing.T) {
 	)
 }
 
+func Test_ParserOrds_MarshalJSON(t *testing.T) {
+	test := func(exp string, ords Ords, typ any) {
+		t.Helper()
+
+		var par ParserOrds
+		par.OrType(typ)
+		par.Ords = ords
+
+		eq(t, exp, string(try1(json.Marshal(par))))
+		eq(t, exp, string(try1(json.Marshal(par.Ords))))
+		eq(t, `{"Ords":`+exp+`}`, string(try1(json.Marshal(struct{ Ords ParserOrds }{par}))))
+	}
+
+	test(`null`, nil, nil)
+	test(`null`, nil, Outer{})
+	test(`[["outer_id"]]`, Ords{OrdAsc{`outer_id`}}, nil)
+	test(`[["outer_id"]]`, Ords{OrdAsc{`outer_id`}}, Outer{})
+	test(`[["outer_id"],"random()"]`, Ords{Path{`outer_id`}, Str(`random()`)}, Outer{})
+}
+
+func Test_ParserOrds_Strings(t *testing.T) {
+	test := func(exp []string, ords Ords, typ any) {
+		t.Helper()
+
+		var par ParserOrds
+		par.OrType(typ)
+		par.Ords = ords
+		eq(t, exp, try1(par.Strings()))
+	}
+
+	test(nil, nil, Outer{})
+	test(nil, Ords{nil}, Outer{})
+	test([]string{`outerId`}, Ords{Path{`outer_id`}}, Outer{})
+	test([]string{`outerId`}, Ords{Ident(`outer_id`)}, Outer{})
+	test([]string{`embedId desc nulls last`}, Ords{OrdDescNullsLast{`embed_id`}}, Outer{})
+
+	test(
+		[]string{`externalInternal.internalId asc`, `externalName nulls first`},
+		Ords{OrdAsc{`internal`, `id`}, nil, Ord{Path: Path{`name`}, Nulls: NullsFirst}},
+		External{},
+	)
+
+	var par ParserOrds
+	par.OrType(Outer{})
+	try(par.ParseSlice([]string{`outerId asc`, `embedName desc nulls first`}))
+
+	var out ParserOrds
+	out.OrType(Outer{})
+	try(out.ParseSlice(try1(par.Strings())))
+	eq(t, par.Ords, out.Ords)
+
+	panics(t, `no JSON path corresponding to DB path "missing" in type sqlb.Outer`, func() {
+		test(nil, Ords{Path{`outer_id`}, Path{`missing`}}, Outer{})
+	})
+
+	panics(t, `unsupported ordering expression of type sqlb.Str`, func() {
+		test(nil, Ords{Path{`outer_id`}, Str(`random()`)}, Outer{})
+	})
+}
+
+type OrdSameCol struct {
+	Short string `json:"a"    db:"col"`
+	Long  string `json:"long" db:"col" ord:""`
+	Id    string `json:"id"   db:"id"`
+	Name  string `json:"name" db:"name" ord:""`
+}
+
+func Test_ParserOrds_Strings_filter(t *testing.T) {
+	opt := ParseOpt{
+		Type:   typeElemOf(OrdSameCol{}),
+		Filter: TagFilter(`ord`),
+	}
+
+	par := ParserOrds{Ords: Ords{OrdDesc{`col`}}, ParseOpt: opt}
+	eq(t, []string{`long desc`}, try1(par.Strings()))
+	eq(t, `-long`, string(try1(par.MarshalText())))
+
+	par.Filter = nil
+	eq(t, []string{`a desc`}, try1(par.Strings()))
+
+	par.Filter = opt.Filter
+	par.Ords = Ords{Path{`id`}}
+	panics(t, `no JSON path corresponding to DB path "id" in type sqlb.OrdSameCol`, func() {
+		try1(par.Strings())
+	})
+}
+
+func Test_ParserOrds_round_trip_filter(t *testing.T) {
+	opt := ParseOpt{
+		Type:     typeElemOf(OrdSameCol{}),
+		Filter:   TagFilter(`ord`),
+		Tiebreak: `id`,
+	}
+
+	test := func(expText string, expOrds Ords, opt ParseOpt, src string) {
+		t.Helper()
+
+		par := ParserOrds{ParseOpt: opt}
+		try(par.ParseText(src))
+		eq(t, expOrds, par.Ords)
+
+		text := try1(par.MarshalText())
+		eq(t, expText, string(text))
+
+		out := ParserOrds{ParseOpt: opt}
+		try(out.UnmarshalText(text))
+		eq(t, par.Ords, out.Ords)
+
+		out = ParserOrds{ParseOpt: opt}
+		try(json.Unmarshal(try1(json.Marshal(try1(par.Strings()))), &out))
+		eq(t, par.Ords, out.Ords)
+	}
+
+	test(``, Ords{Path{`id`}}, opt, ``)
+	test(`-name`, Ords{OrdDesc{`name`}, Path{`id`}}, opt, `-name`)
+	test(`-name,long.asc`, Ords{OrdDesc{`name`}, OrdAsc{`col`}, Path{`id`}}, opt, `-name,long.asc`)
+
+	opt.Default = `-id`
+	test(``, Ords{OrdDesc{`id`}}, opt, ``)
+	test(`name`, Ords{Path{`name`}, Path{`id`}}, opt, `name`)
+
+	opt.Default = `name,-id`
+	test(``, Ords{Path{`name`}, OrdDesc{`id`}}, opt, ``)
+	test(`name.asc`, Ords{OrdAsc{`name`}, Path{`id`}}, opt, `name.asc`)
+}
+
+func Test_ParserOrds_MarshalText(t *testing.T) {
+	test := func(exp string, ords Ords) {
+		t.Helper()
+
+		var par ParserOrds
+		par.OrType(External{})
+		par.Ords = ords
+		eq(t, exp, string(try1(par.MarshalText())))
+
+		var out ParserOrds
+		out.OrType(External{})
+		try(out.UnmarshalText([]byte(exp)))
+		eq(t, Ords(par.Ords).Len(), out.Len())
+		eq(t, exp, string(try1(out.MarshalText())))
+	}
+
+	test(``, nil)
+	test(`externalId`, Ords{Path{`id`}})
+	test(`externalId.asc`, Ords{OrdAsc{`id`}})
+	test(`-externalId`, Ords{OrdDesc{`id`}})
+	test(`externalId.nullslast`, Ords{OrdNullsLast{`id`}})
+	test(`-externalInternal.internalName.nullsfirst`, Ords{OrdDescNullsFirst{`internal`, `name`}})
+	test(`externalName.asc.nullslast,-externalId`, Ords{OrdAscNullsLast{`name`}, nil, OrdDesc{`id`}})
+
+	var par ParserOrds
+	par.OrType(External{})
+	par.Ords = Ords{OrdDesc{`id`}, Str(`random()`)}
+	panics(t, `unsupported ordering expression of type sqlb.Str`, func() {
+		try1(par.MarshalText())
+	})
+}
+
 func Test_ParserOrds_ParseSlice_invalid(t *testing.T) {
 	test := func(src, msg string, typ any) {
 		t.Helper()
@@ -207,6 +368,77 @@ func Test_ParserOrds_ParseSlice_invalid(t *testing.T) {
 	test(`onlyJson`, `error "ErrUnknownField" while converting JSON identifier path to DB path: no DB path corresponding to JSON path "onlyJson" in type Outer`, Outer{})
 }
 
+/*
+Reference implementation, formerly used by `OrdsParser`. The hand-written
+parser must be equivalent to it.
+*/
+var ordReg = regexp.MustCompile(
+	`^\s*((?:\w+\.)*\w+)(?i)(?:\s+(asc|desc))?(?:\s+nulls\s+(first|last))?\s*$`,
+)
+
+func Test_parseOrd(t *testing.T) {
+	test := func(src string) {
+		t.Helper()
+
+		var exp R
+		match := ordReg.FindStringSubmatch(src)
+		if match != nil {
+			exp = R{match[1], list{strDir(match[2]), strNulls(match[3])}}
+		}
+
+		var act R
+		path, dir, nulls, ok := parseOrd(src)
+		if ok {
+			act = R{path, list{dir, nulls}}
+		}
+
+		eq(t, exp, act)
+	}
+
+	test(``)
+	test(` `)
+	test(`.`)
+	test(`one`)
+	test(`one_two`)
+	test(`One2`)
+	test(`123`)
+	test(`one.two`)
+	test(`one.two.three`)
+	test(`.one`)
+	test(`one.`)
+	test(`one..two`)
+	test(`one-two`)
+	test(`one two`)
+	test(`one two three`)
+	test(" \t\n\r\fone\t\n\r\f ")
+	test("one\v")
+	test(`one asc`)
+	test(`one ASC`)
+	test(`one desc`)
+	test(`one DeSc`)
+	test(`one ascdesc`)
+	test(`one asc desc`)
+	test(`one.two   desc  `)
+	test(`one nulls`)
+	test(`one nulls first`)
+	test(`one NULLS LAST`)
+	test(`one nulls middle`)
+	test(`one nullsfirst`)
+	test(`one asc nulls`)
+	test(`one asc nulls first`)
+	test(`one desc nulls last`)
+	test(`one desc nulls last `)
+	test(`one desc nulls last desc`)
+	test(`one nulls last asc`)
+	test(`one asc asc`)
+	test(`asc`)
+	test(`asc asc`)
+	test(`nulls`)
+	test(`nulls nulls first`)
+	test(`one asc`)
+	test(`oné`)
+}
+
 func testOrdsParsing(t testing.TB, exp Ords, src []string, typ any) {
 	t.Helper()
 
@@ -295,6 +527,233 @@ func Test_ParserOrds_ParseSlice_lax(t *testing.T) {
 	test([]string{`outer_id`}, Outer{})
 }
 
+func Test_ParserOrds_ParseText(t *testing.T) {
+	test := func(exp Ords, src string, typ any) {
+		t.Helper()
+
+		var par ParserOrds
+		par.OrType(typ)
+		try(par.ParseText(src))
+		eq(t, exp, par.Ords)
+
+		var tar ParserOrds
+		tar.OrType(typ)
+		try(tar.UnmarshalText([]byte(src)))
+		eq(t, exp, tar.Ords)
+	}
+
+	test(Ords(nil), ``, Outer{})
+	test(Ords(nil), ` `, Outer{})
+	test(Ords{}, ` , ,`, Outer{})
+	test(Ords{Path{`outer_id`}}, `outerId`, Outer{})
+	test(Ords{OrdDesc{`outer_id`}}, `-outerId`, Outer{})
+	test(Ords{OrdAsc{`outer_id`}}, `+outerId`, Outer{})
+	test(Ords{OrdAsc{`outer_id`}}, `outerId.asc`, Outer{})
+	test(Ords{OrdDesc{`outer_id`}}, `outerId.DESC`, Outer{})
+	test(Ords{OrdNullsFirst{`outer_id`}}, `outerId.nullsfirst`, Outer{})
+	test(Ords{OrdNullsLast{`outer_id`}}, `outerId.NullsLast`, Outer{})
+	test(Ords{OrdAscNullsLast{`outer_id`}}, `outerId.asc.nullslast`, Outer{})
+	test(Ords{OrdAscNullsLast{`outer_id`}}, `outerId.nullslast.asc`, Outer{})
+	test(Ords{OrdDescNullsFirst{`outer_id`}}, `-outerId.nullsfirst`, Outer{})
+	test(Ords{OrdDescNullsLast{`outer_id`}}, `outerId desc nulls last`, Outer{})
+	test(Ords{OrdDescNullsLast{`outer_id`}}, `-outerId nulls last`, Outer{})
+	test(Ords{OrdDesc{`internal`, `id`}}, `-externalInternal.internalId`, External{})
+	test(Ords{OrdAsc{`internal`, `name`}}, `externalInternal.internalName.asc`, External{})
+
+	test(
+		Ords{OrdDesc{`outer_id`}, OrdAscNullsLast{`outer_name`}, Path{`embed_id`}},
+		` -outerId , ,outerName.asc.nullslast,embedId, `,
+		Outer{},
+	)
+}
+
+func Test_ParserOrds_ParseText_invalid(t *testing.T) {
+	test := func(msg, src string) {
+		t.Helper()
+		var par ParserOrds
+		par.OrType(Outer{})
+		panics(t, msg, func() { try(par.ParseText(src)) })
+	}
+
+	test(`"-" is not a valid ordering string`, `-`)
+	test(`".asc" is not a valid ordering string`, `.asc`)
+	test(`"outerId." is not a valid ordering string`, `outerId.`)
+	test(`"-outerId.asc" is not a valid ordering string`, `-outerId.asc`)
+	test(`"-outerId desc" is not a valid ordering string`, `-outerId desc`)
+	test(`no DB path corresponding to JSON path "outerId.asc"`, `outerId.asc.desc`)
+	test(`"outerId nulls last.nullsfirst" is not a valid ordering string`, `outerId nulls last.nullsfirst`)
+	test(`"--outerId" is not a valid ordering string`, `outerId,--outerId`)
+	test(`no DB path corresponding to JSON path "outerId.nulls"`, `outerId.nulls`)
+	test(`no DB path corresponding to JSON path "missing"`, `outerId,-missing`)
+}
+
+func Test_ParserOrds_ParseText_lax(t *testing.T) {
+	var par ParserOrds
+	par.OrType(Outer{})
+	par.Lax = true
+
+	try(par.ParseText(`-missing,outerId.asc,missing.desc`))
+	eq(t, Ords{OrdAsc{`outer_id`}}, par.Ords)
+}
+
+func Test_ParseOpt_Default(t *testing.T) {
+	test := func(exp Ords, src []string) {
+		t.Helper()
+
+		var par ParserOrds
+		par.OrType(Outer{})
+		par.Lax = true
+		par.Filter = TagFilter(`missing`)
+		par.Default = `-outerName,,embedId`
+
+		try(par.ParseSlice(src))
+		eq(t, exp, par.Ords)
+	}
+
+	test(Ords{OrdDesc{`outer_name`}, Path{`embed_id`}}, nil)
+	test(Ords{OrdDesc{`outer_name`}, Path{`embed_id`}}, []string{``})
+	test(Ords{OrdDesc{`outer_name`}, Path{`embed_id`}}, []string{`outerId`})
+
+	var par ParserOrds
+	par.OrType(Outer{})
+	par.Default = `outerName desc`
+
+	try(par.ParseSlice([]string{`outerId`}))
+	eq(t, Ords{Path{`outer_id`}}, par.Ords)
+
+	try(par.ParseText(``))
+	eq(t, Ords{OrdDesc{`outer_name`}}, par.Ords)
+
+	par.Default = `missing`
+	panics(t, `no DB path corresponding to JSON path "missing"`, func() {
+		try(par.ParseSlice(nil))
+	})
+
+	opt := par.ParseOpt
+	eq(t, true, opt == par.ParseOpt)
+}
+
+func Test_ParseOpt_Max(t *testing.T) {
+	var par ParserOrds
+	par.OrType(Outer{})
+	par.Max = 2
+	par.Lax = true
+
+	try(par.ParseSlice([]string{`outerId`, ``, `missing`}))
+	eq(t, Ords{Path{`outer_id`}}, par.Ords)
+
+	try(par.ParseText(`outerId,,-outerName`))
+	eq(t, Ords{Path{`outer_id`}, OrdDesc{`outer_name`}}, par.Ords)
+
+	panics(t, `too many orderings: expected at most 2, found 3`, func() {
+		try(par.ParseSlice([]string{`outerId`, `outerName`, `missing`}))
+	})
+
+	panics(t, `too many orderings: expected at most 2, found 3`, func() {
+		try(par.ParseText(`outerId,outerName,missing`))
+	})
+}
+
+func Test_ParseOpt_Tiebreak(t *testing.T) {
+	test := func(exp Ords, src []string) {
+		t.Helper()
+
+		var par ParserOrds
+		par.OrType(External{})
+		par.Filter = TagFilter(`missing`)
+		par.Lax = true
+		par.Max = 1
+		par.Tiebreak = `externalId`
+
+		try(par.ParseSlice(src))
+		eq(t, exp, par.Ords)
+	}
+
+	test(Ords{Path{`id`}}, nil)
+	test(Ords{Path{`id`}}, []string{`externalName`})
+
+	var par ParserOrds
+	par.OrType(External{})
+	par.Max = 1
+	par.Tiebreak = `externalId`
+
+	try(par.ParseSlice([]string{`externalName desc`}))
+	eq(t, Ords{OrdDesc{`name`}, Path{`id`}}, par.Ords)
+
+	try(par.ParseText(`-externalId`))
+	eq(t, Ords{OrdDesc{`id`}}, par.Ords)
+
+	try(par.ParseText(`externalInternal.internalId`))
+	eq(t, Ords{Path{`internal`, `id`}, Path{`id`}}, par.Ords)
+
+	par.Default = `externalName`
+	try(par.ParseSlice(nil))
+	eq(t, Ords{Path{`name`}, Path{`id`}}, par.Ords)
+
+	par.Tiebreak = `missing`
+	panics(t, `error "sqlb.ErrUnknownField" while resolving ordering tiebreaker: no DB path corresponding to JSON path "missing"`, func() {
+		try(par.ParseSlice(nil))
+	})
+
+	tar := struct {
+		Id string `json:"id" db:"id" ord.dir:"desc"`
+	}{}
+
+	var dir ParserOrds
+	dir.OrType(tar)
+	dir.Tiebreak = `id`
+	try(dir.ParseSlice(nil))
+	eq(t, Ords{OrdDesc{`id`}}, dir.Ords)
+}
+
+type OrdExprOuter struct{ Outer }
+
+func (OrdExprOuter) OrdExprs() map[string]Expr {
+	return map[string]Expr{
+		`lowerName`:    Str(`lower("outer_name")`),
+		`rank.current`: Call{`rank`, Path{`outer_id`}},
+		`outerId`:      Str(`shadowed`),
+	}
+}
+
+type OrdExprInvalid struct{ Outer }
+
+func (*OrdExprInvalid) OrdExprs() map[string]Expr {
+	return map[string]Expr{`lower name`: Str(`lower("outer_name")`)}
+}
+
+func Test_OrdExprer(t *testing.T) {
+	lower := namedOrdExpr{`lowerName`, Str(`lower("outer_name")`)}
+	rank := namedOrdExpr{`rank.current`, Call{`rank`, Path{`outer_id`}}}
+
+	var par ParserOrds
+	par.OrType(OrdExprOuter{})
+	par.Filter = TagFilter(`missing`)
+	par.Lax = true
+
+	try(par.ParseSlice([]string{`lowerName desc nulls last`, `outerId`, `rank.current`}))
+	eq(t, Ords{Ordering{Expr: lower, Dir: DirDesc, Nulls: NullsLast}, Ordering{Expr: rank}}, par.Ords)
+	eq(t, `order by lower("outer_name") desc nulls last, rank ("outer_id")`, par.Ords.String())
+
+	par.Filter = nil
+	par.Lax = false
+
+	try(par.ParseText(`-lowerName,outerId.asc`))
+	eq(t, Ords{Ordering{Expr: lower, Dir: DirDesc}, OrdAsc{`outer_id`}}, par.Ords)
+	eq(t, `-lowerName,outerId.asc`, string(try1(par.MarshalText())))
+	eq(t, []string{`lowerName desc`, `outerId asc`}, try1(par.Strings()))
+
+	panics(t, `no DB path corresponding to JSON path "upperName" in type sqlb.OrdExprOuter`, func() {
+		try(par.ParseSlice([]string{`upperName`}))
+	})
+
+	panics(t, `invalid ordering expression name "lower name" in type sqlb.OrdExprInvalid`, func() {
+		var par ParserOrds
+		par.OrType(OrdExprInvalid{})
+		try(par.ParseSlice([]string{`lowerName`}))
+	})
+}
+
 func Test_ParseOpt_Filter(t *testing.T) {
 	type Target struct {
 		Tagged   string `json:"jsonTagged"   db:"db_tagged" ord:""`
@@ -486,3 +945,144 @@ func TestDir(t *testing.T) {
 		test(DirDesc, `"desc"`)
 	})
 }
+
+type KeysetRow struct {
+	Id       int64    `json:"id"       db:"id"`
+	Name     *string  `json:"name"     db:"name"`
+	Internal Internal `json:"internal" db:"internal"`
+}
+
+func Test_Keyset_Expr(t *testing.T) {
+	name := `name`
+
+	test := func(exp R, ords Ords, row KeysetRow) {
+		t.Helper()
+		tar := Keyset{Ords: ords}
+		try(tar.SetLast(row))
+		eq(t, exp, reify(tar))
+	}
+
+	eq(t, rei(`true`), reify(Keyset{Ords: Ords{OrdAsc{`id`}}}))
+
+	test(rei(`true`), Ords{}, KeysetRow{})
+	test(rei(`"id" > $1`, int64(10)), Ords{OrdAscNullsFirst{`id`}}, KeysetRow{Id: 10})
+	test(rei(`"id" < $1`, int64(10)), Ords{OrdDesc{`id`}}, KeysetRow{Id: 10})
+	test(rei(`("id" > $1 or "id" is null)`, int64(10)), Ords{Path{`id`}}, KeysetRow{Id: 10})
+	test(rei(`("id" > $1 or "id" is null)`, int64(10)), Ords{OrdAsc{`id`}}, KeysetRow{Id: 10})
+	test(rei(`("id" < $1 or "id" is null)`, int64(10)), Ords{OrdDescNullsLast{`id`}}, KeysetRow{Id: 10})
+	test(rei(`false`), Ords{OrdAsc{`name`}}, KeysetRow{})
+	test(rei(`"name" is not null`), Ords{OrdDesc{`name`}}, KeysetRow{})
+	test(rei(`"name" is not null`), Ords{OrdAscNullsFirst{`name`}}, KeysetRow{})
+
+	test(
+		rei(`(("internal")."name" > $1 or ("internal")."name" is null)`, `inner`),
+		Ords{OrdAsc{`internal`, `name`}},
+		KeysetRow{Internal: Internal{Name: `inner`}},
+	)
+
+	test(
+		rei(
+			`(("name" > $1 or "name" is null) or ("name" = $2 and "id" < $3))`,
+			&name, &name, int64(10),
+		),
+		Ords{OrdAsc{`name`}, OrdDescNullsFirst{`id`}},
+		KeysetRow{Id: 10, Name: &name},
+	)
+
+	test(
+		rei(`("name" is null and "id" < $1)`, int64(10)),
+		Ords{OrdAsc{`name`}, OrdDescNullsFirst{`id`}},
+		KeysetRow{Id: 10},
+	)
+
+	test(
+		rei(`("name" is not null or ("name" is null and ("id" > $1 or "id" is null)))`, int64(10)),
+		Ords{nil, OrdDesc{`name`}, nil, OrdAsc{`id`}},
+		KeysetRow{Id: 10},
+	)
+}
+
+type KeysetRef struct {
+	Val *Internal `role:"ref"`
+}
+
+type KeysetRefRow struct {
+	Id  int64     `json:"id"  db:"id"`
+	Ref KeysetRef `json:"ref" db:"ref"`
+}
+
+func Test_Keyset_ref(t *testing.T) {
+	tar := Keyset{Ords: Ords{OrdAsc{`ref`, `id`}, OrdAsc{`id`}}}
+	try(tar.SetLast(KeysetRefRow{Id: 10, Ref: KeysetRef{&Internal{Id: `inner`}}}))
+	eq(t, []any{`inner`, int64(10)}, tar.Vals)
+
+	eq(
+		t,
+		rei(
+			`((("ref")."id" > $1 or ("ref")."id" is null) or (("ref")."id" = $2 and ("id" > $3 or "id" is null)))`,
+			`inner`, `inner`, int64(10),
+		),
+		reify(tar),
+	)
+
+	try(tar.SetLast(KeysetRefRow{Id: 10}))
+	eq(t, []any{nil, int64(10)}, tar.Vals)
+}
+
+func Test_Keyset_invalid(t *testing.T) {
+	panics(t, `expected a value of type sqlb.KeysetRow, found sqlb.Outer`, func() {
+		tar := Keyset{Ords: Ords{OrdAsc{`id`}}, Type: typeOf(KeysetRow{})}
+		try(tar.SetLast(Outer{}))
+	})
+
+	panics(t, `no field corresponding to DB path "missing" in type sqlb.KeysetRow`, func() {
+		tar := Keyset{Ords: Ords{OrdAsc{`missing`}}}
+		try(tar.SetLast(KeysetRow{}))
+	})
+
+	panics(t, `unsupported ordering expression of type sqlb.Str`, func() {
+		tar := Keyset{Ords: Ords{Str(`id`)}}
+		try(tar.SetLast(KeysetRow{}))
+	})
+
+	panics(t, `mismatch between orderings and values: 1 orderings, 2 values`, func() {
+		_ = Keyset{Ords: Ords{OrdAsc{`id`}}, Type: typeOf(KeysetRow{}), Vals: []any{10, 20}}.String()
+	})
+}
+
+func Test_Keyset_Cursor(t *testing.T) {
+	var par ParserOrds
+	par.OrType(KeysetRow{})
+	try(par.ParseSlice([]string{`name desc`, `internal.internalName`, `id`}))
+
+	name := `name`
+	src := par.Keyset()
+	eq(t, ``, try1(src.Cursor()))
+
+	try(src.SetLast(&KeysetRow{Id: 10, Name: &name, Internal: Internal{Name: `inner`}}))
+	cursor := try1(src.Cursor())
+
+	tar := par.Keyset()
+	try(tar.ParseCursor(cursor))
+	eq(t, src.Vals, tar.Vals)
+	eq(t, reify(src), reify(tar))
+
+	try(tar.ParseCursor(``))
+	eq(t, 0, len(tar.Vals))
+
+	try(src.SetLast(&KeysetRow{}))
+	try(tar.ParseCursor(try1(src.Cursor())))
+	eq(t, []any{(*string)(nil), ``, int64(0)}, tar.Vals)
+
+	panics(t, `illegal base64 data`, func() { try(tar.ParseCursor(`!`)) })
+	panics(t, `invalid character`, func() { try(tar.ParseCursor(`bm90IGpzb24`)) })
+
+	text := string(try1(base64.RawURLEncoding.DecodeString(cursor)))
+	eq(t, false, strings.Contains(text, `internal`))
+	eq(t, false, strings.Contains(text, `desc`))
+
+	panics(t, `cursor doesn't match the current ordering`, func() {
+		other := Keyset{Ords: Ords{OrdAsc{`id`}}, Type: typeOf(KeysetRow{})}
+		try(other.ParseCursor(cursor))
+	})
+}
@@ -0,0 +1,229 @@
+package sqlb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+)
+
+/*
+Minimal fake driver for testing the execution helpers. Records every query
+with its arguments, and returns the rows configured for the next query.
+*/
+type testDriver struct {
+	queries []R
+	cols    []string
+	rows    [][]driver.Value
+}
+
+func (self *testDriver) db() *sql.DB { return sql.OpenDB(self) }
+
+func (self *testDriver) respond(cols []string, rows ...[]driver.Value) {
+	self.cols = cols
+	self.rows = rows
+}
+
+// Implement `driver.Connector`.
+func (self *testDriver) Connect(context.Context) (driver.Conn, error) {
+	return testConn{self}, nil
+}
+
+// Implement `driver.Connector`.
+func (self *testDriver) Driver() driver.Driver { return self }
+
+// Implement `driver.Driver`.
+func (self *testDriver) Open(string) (driver.Conn, error) { return testConn{self}, nil }
+
+func (self *testDriver) record(query string, args []driver.NamedValue) {
+	var vals []any
+	for _, val := range args {
+		vals = append(vals, val.Value)
+	}
+	self.queries = append(self.queries, rei(query, vals...))
+}
+
+type testConn struct{ *testDriver }
+
+func (self testConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New(`unexpected prepare`)
+}
+
+func (self testConn) Close() error { return nil }
+
+func (self testConn) Begin() (driver.Tx, error) { return testTx{}, nil }
+
+// Implement `driver.ExecerContext`.
+func (self testConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	self.record(query, args)
+	return driver.RowsAffected(len(args)), nil
+}
+
+// Implement `driver.QueryerContext`.
+func (self testConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	self.record(query, args)
+	out := &testRows{cols: self.cols, rows: self.rows}
+	self.cols, self.rows = nil, nil
+	return out, nil
+}
+
+type testTx struct{}
+
+func (testTx) Commit() error   { return nil }
+func (testTx) Rollback() error { return nil }
+
+type testRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (self *testRows) Columns() []string { return self.cols }
+
+func (self *testRows) Close() error { return nil }
+
+func (self *testRows) Next(out []driver.Value) error {
+	if len(self.rows) <= 0 {
+		return io.EOF
+	}
+	copy(out, self.rows[0])
+	self.rows = self.rows[1:]
+	return nil
+}
+
+func TestExec(t *testing.T) {
+	var drv testDriver
+	db := drv.db()
+	defer db.Close()
+	ctx := context.Background()
+
+	res, err := Exec(ctx, db, StrQ{`delete from persons where id = :id`, Dict{`id`: 10}})
+	try(err)
+	eq(t, int64(1), try1(res.RowsAffected()))
+	eq(t, []R{rei(`delete from persons where id = $1`, int64(10))}, drv.queries)
+
+	res, err = Exec(ctx, db, StrQ{`delete from persons where id = :id`, Dict{}})
+	eq(t, nil, res)
+	eq(t, true, errors.As(err, new(ErrMissingArgument)))
+	eq(t, 1, len(drv.queries))
+
+	t.Run(`tx`, func(t *testing.T) {
+		tx := try1(db.BeginTx(ctx, nil))
+		defer tx.Rollback()
+
+		_, err := Exec(ctx, tx, Str(`select 1`))
+		try(err)
+		eq(t, rei(`select 1`), drv.queries[len(drv.queries)-1])
+	})
+
+	t.Run(`conn`, func(t *testing.T) {
+		conn := try1(db.Conn(ctx))
+		defer conn.Close()
+
+		_, err := Exec(ctx, conn, Str(`select 2`))
+		try(err)
+		eq(t, rei(`select 2`), drv.queries[len(drv.queries)-1])
+	})
+}
+
+func TestQuery(t *testing.T) {
+	var drv testDriver
+	db := drv.db()
+	defer db.Close()
+	ctx := context.Background()
+
+	drv.respond([]string{`id`}, []driver.Value{int64(10)}, []driver.Value{int64(20)})
+
+	rows, err := Query(ctx, db, Select{`persons`, Eq{Ident(`name`), `one`}})
+	try(err)
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		try(rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	try(rows.Err())
+
+	eq(t, []int64{10, 20}, ids)
+	eq(t, []R{rei(`select * from "persons" where ("name") = $1`, `one`)}, drv.queries)
+
+	rows, err = Query(ctx, db, ListQ(`select $2`, 10))
+	eq(t, (*sql.Rows)(nil), rows)
+	eq(t, true, errors.As(err, new(ErrMissingArgument)))
+	eq(t, 1, len(drv.queries))
+}
+
+func TestQueryRow(t *testing.T) {
+	var drv testDriver
+	db := drv.db()
+	defer db.Close()
+	ctx := context.Background()
+
+	drv.respond([]string{`id`, `name`}, []driver.Value{int64(10), `one`})
+
+	var id int64
+	var name string
+	try(QueryRow(ctx, db, ListQ(`select id, name from persons where id = $1`, 10), &id, &name))
+	eq(t, int64(10), id)
+	eq(t, `one`, name)
+
+	err := QueryRow(ctx, db, ListQ(`select id from persons where id = $1`, 20), &id)
+	eq(t, true, errors.Is(err, sql.ErrNoRows))
+
+	err = QueryRow(ctx, db, ListQ(`select id from persons`, 30), &id)
+	eq(t, true, errors.As(err, new(ErrInvalidInput)))
+
+	eq(
+		t,
+		[]R{
+			rei(`select id, name from persons where id = $1`, int64(10)),
+			rei(`select id from persons where id = $1`, int64(20)),
+		},
+		drv.queries,
+	)
+}
+
+func TestExists(t *testing.T) {
+	var drv testDriver
+	db := drv.db()
+	defer db.Close()
+	ctx := context.Background()
+
+	drv.respond([]string{`exists`}, []driver.Value{true})
+	eq(t, true, try1(Exists(ctx, db, Select{`persons`, Eq{Ident(`id`), 10}})))
+
+	drv.respond([]string{`exists`}, []driver.Value{false})
+	eq(t, false, try1(Exists(ctx, db, Str(`select 1 where false`))))
+
+	eq(
+		t,
+		[]R{
+			rei(`select exists(select * from "persons" where ("id") = $1)`, int64(10)),
+			rei(`select exists(select 1 where false)`),
+		},
+		drv.queries,
+	)
+}
+
+func TestCount(t *testing.T) {
+	var drv testDriver
+	db := drv.db()
+	defer db.Close()
+	ctx := context.Background()
+
+	drv.respond([]string{`count`}, []driver.Value{int64(3)})
+	eq(t, int64(3), try1(Count(ctx, db, Select{`persons`, Eq{Ident(`id`), 10}})))
+
+	eq(
+		t,
+		[]R{rei(`with _ as (select * from "persons" where ("id") = $1) select count(*) from _`, int64(10))},
+		drv.queries,
+	)
+
+	out, err := Count(ctx, db, StrQ{`select :missing`, Dict{}})
+	eq(t, int64(0), out)
+	eq(t, true, errors.As(err, new(ErrMissingArgument)))
+}
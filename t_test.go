@@ -1,9 +1,16 @@
 package sqlb
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	r "reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -852,6 +859,55 @@ func TestStructsInsert(t *testing.T) {
 	)
 }
 
+func TestStructsInsert_Batches(t *testing.T) {
+	rows := StructsInsertOf(
+		PairStruct{10, 20},
+		PairStruct{30, 40},
+		PairStruct{Str(`default`), 50},
+		PairStruct{60, 70},
+		PairStruct{80, 90},
+	)
+
+	test := func(limit int, exp ...StructsInsert[PairStruct]) {
+		t.Helper()
+		eq(t, exp, rows.Batches(limit))
+	}
+
+	test(0, rows)
+	test(-1, rows)
+	test(PostgresParamLimit, rows)
+	test(9, rows)
+	test(8, rows[:4], rows[4:])
+	test(5, rows[:3], rows[3:])
+	test(4, rows[:2], rows[2:4], rows[4:])
+	test(3, rows[:1], rows[1:3], rows[3:4], rows[4:])
+	test(2, rows[:1], rows[1:2], rows[2:3], rows[3:4], rows[4:])
+
+	eq(t, []StructsInsert[PairStruct](nil), StructsInsert[PairStruct](nil).Batches(10))
+
+	panics(t, `expected row with at most 1 parameters, found row 0 with 2 parameters`, func() {
+		rows.Batches(1)
+	})
+
+	batches := rows.Batches(5)
+
+	testExpr(
+		t,
+		rei(`("one", "two") values ($1, $2), ($3, $4), ((default), $5)`, 10, 20, 30, 40, 50),
+		batches[0],
+	)
+
+	testExpr(
+		t,
+		rei(`("one", "two") values ($1, $2), ($3, $4)`, 60, 70, 80, 90),
+		batches[1],
+	)
+
+	// Appending to a batch must not affect the next batch.
+	_ = append(batches[0], PairStruct{100, 110})
+	eq(t, PairStruct{60, 70}, batches[1][0])
+}
+
 func TestStructAssign(t *testing.T) {
 	panics(t, `assignment must have at least one field`, func() {
 		StructAssign{}.AppendExpr(nil, nil)
@@ -1391,6 +1447,233 @@ func TestStrQ_without_args(t *testing.T) {
 	})
 }
 
+func TestStrQ_missing_arg_position(t *testing.T) {
+	panics(t, "missing ordinal argument \"$2\" (index 1) at line 1, column 22:\n\tselect * where one = $2\n\t                     ^", func() {
+		ListQ(`select * where one = $2`, 10).AppendExpr(nil, nil)
+	})
+
+	panics(t, "missing named argument \":two\" (key \"two\") at line 4, column 13:\n\t\t\tand two = :two\n\t\t\t          ^", func() {
+		StrQ{"\n\tselect * where one = :one\n\r\n\t\tand two = :two\n", Dict{`one`: 10}}.AppendExpr(nil, nil)
+	})
+
+	panics(t, "missing named argument \":three\" (key \"three\") at line 3, column 8:\n\t'ü' || :three\n\t       ^", func() {
+		StrQ{"/* ünïcode */\r-- ünïcode\r\n'ü' || :three", Dict{}}.AppendExpr(nil, nil)
+	})
+}
+
+func TestStrQ_dotted_fallback(t *testing.T) {
+	testExpr(
+		t,
+		rei(`select "t".col from "t"`),
+		StrQ{`select :alias.col from :alias`, Dict{`alias`: Ident(`t`)}},
+	)
+
+	testExpr(
+		t,
+		rei(`select $1, $1, $2`, 20, 10),
+		StrQ{`select :one.two, :one.two, :one`, Dict{`one`: 10, `one.two`: 20}},
+	)
+
+	testExpr(
+		t,
+		rei(`select "t".col`),
+		StructQ(`select :Alias.col`, struct{ Alias Ident }{`t`}),
+	)
+
+	testExpr(
+		t,
+		rei(`select "t".col`),
+		StrQ{`select :alias.col`, ArgDicts{Dict{`alias`: Ident(`t`)}}},
+	)
+
+	panics(t, `missing named argument ":alias.col"`, func() {
+		StrQ{`select :alias.col`, Dict{`other`: 10}}.AppendExpr(nil, nil)
+	})
+
+	panics(t, `missing named argument ":alias.col"`, func() {
+		StrQ{`select :alias.col`, ArgDicts{PathDict{Val: Dict{`alias`: 10}}}}.AppendExpr(nil, nil)
+	})
+
+	panics(t, `unused named argument ":alias"`, func() {
+		StrQ{`select :alias.col`, Dict{`alias.col`: 10, `alias`: 20}}.AppendExpr(nil, nil)
+	})
+
+	text, args, binds := StrQ{`select :one.two, :one`, Dict{`one`: 10}}.ReifyBindings()
+	eq(t, `select $1.two, $1`, text)
+	eq(t, []any{10}, args)
+	eq(t, []ParamBinding{{`:one`, 1, 10}}, binds)
+}
+
+func TestStrQ_ReuseArgs(t *testing.T) {
+	cond := Eq{Ident(`one`), 10}
+
+	testExpr(
+		t,
+		rei(`select $1 where ("one") = $2 and ("one") = $3 and $1`, 20, 10, 10),
+		StrQ{`select :val where :cond and :cond and :val`, Dict{`val`: 20, `cond`: cond}},
+	)
+
+	testExpr(
+		t,
+		rei(`select $1 where ("one") = $2 and ("one") = $2 and $1`, 20, 10),
+		StrQ{`select :val where :cond and :cond and :val`, ReuseArgs{Dict{`val`: 20, `cond`: cond}}},
+	)
+
+	testExpr(
+		t,
+		rei(`select $1 where ("one") = $2 or ("one") = $2`, 20, 10),
+		StrQ{`select $1 where $2 or $2`, ReuseArgs{List{20, cond}}},
+	)
+
+	testExprs(
+		t,
+		rei(`select $1, ("one") = $2, ("one") = $2, ("one") = $3`, 30, 10, 10),
+		StrQ{`select :val,`, ReuseArgs{Dict{`val`: 30}}},
+		StrQ{`:cond, :cond,`, ReuseArgs{Dict{`cond`: cond}}},
+		StrQ{`:cond`, ReuseArgs{Dict{`cond`: cond}}},
+	)
+
+	// Applies only to the query which uses the wrapper directly.
+	testExpr(
+		t,
+		rei(`select ("one") = $1, ("one") = $2`, 10, 10),
+		StrQ{`select :inner`, ReuseArgs{Dict{`inner`: StrQ{`:cond, :cond`, Dict{`cond`: cond}}}}},
+	)
+
+	// Validation of unused arguments is forwarded to the inner dict.
+	panics(t, `unused named argument ":other"`, func() {
+		StrQ{`select :cond`, ReuseArgs{Dict{`cond`: cond, `other`: 10}}}.AppendExpr(nil, nil)
+	})
+
+	testExpr(
+		t,
+		rei(`select ("one") = $1`, 10),
+		StrQ{`select :cond`, ReuseArgs{LaxDict{`cond`: cond, `other`: 10}}},
+	)
+}
+
+func TestStrQ_ReifyBindings(t *testing.T) {
+	cond := Eq{Ident(`one`), 10}
+
+	text, args, binds := StrQ{
+		`select :val, :cond, $1, :val`,
+		ArgDicts{List{30}, Dict{`val`: 20, `cond`: cond}},
+	}.ReifyBindings()
+
+	eq(t, `select $1, ("one") = $2, $3, $1`, text)
+	eq(t, []any{20, 10, 30}, args)
+	eq(
+		t,
+		[]ParamBinding{
+			{`:val`, 1, 20},
+			{`:cond`, 0, cond},
+			{`$1`, 3, 30},
+		},
+		binds,
+	)
+
+	eq(t, `:val -> $1`, binds[0].String())
+	eq(t, `:cond -> ("one") = $1`, binds[1].String())
+
+	text, args, binds = StrQ{`select 1`, nil}.ReifyBindings()
+	eq(t, `select 1`, text)
+	eq(t, []any(nil), args)
+	eq(t, []ParamBinding(nil), binds)
+
+	t.Run(`offset`, func(t *testing.T) {
+		bytes, args, binds := Preparse(`:one, :two, :one`).AppendParamExprBindings(
+			[]byte(`select $1,`), []any{10}, Dict{`one`: 20, `two`: 30},
+		)
+
+		eq(t, `select $1, $2, $3, $2`, string(bytes))
+		eq(t, []any{10, 20, 30}, args)
+		eq(t, []ParamBinding{{`:one`, 2, 20}, {`:two`, 3, 30}}, binds)
+	})
+
+	// The bindings are recorded while rendering, without evaluating the arguments
+	// again, so they always match the rendered arguments.
+	t.Run(`evaluated_once`, func(t *testing.T) {
+		var count int
+
+		text, args, binds := StrQ{
+			`select :GetNext`,
+			StructDict{r.ValueOf(CounterStruct{&count})},
+		}.ReifyBindings()
+
+		eq(t, `select $1`, text)
+		eq(t, []any{1}, args)
+		eq(t, []ParamBinding{{`:GetNext`, 1, 1}}, binds)
+		eq(t, 1, count)
+	})
+}
+
+func TestStrQ_ReifyNamed(t *testing.T) {
+	test := func(style NamedParamStyle, expText string, expArgs []sql.NamedArg, val StrQ) {
+		t.Helper()
+		text, args := val.ReifyNamed(style)
+		eq(t, expText, text)
+		eq(t, expArgs, args)
+	}
+
+	test(NamedParamAt, `select 1`, []sql.NamedArg{}, StrQ{`select 1`, nil})
+
+	test(
+		NamedParamAt,
+		`select @user_id, @filter_min_age, '$1', @user_id`,
+		[]sql.NamedArg{sql.Named(`user_id`, 10), sql.Named(`filter_min_age`, 20)},
+		StrQ{
+			`select :user_id, :filter.min_age, '$1', :user_id`,
+			PathDict{Val: map[string]any{`user_id`: 10, `filter`: map[string]any{`min_age`: 20}}},
+		},
+	)
+
+	test(
+		NamedParamColon,
+		`select :p1, :one, ("two") = :p3_, :p3`,
+		[]sql.NamedArg{sql.Named(`p1`, 10), sql.Named(`one`, 20), sql.Named(`p3_`, 30), sql.Named(`p3`, 40)},
+		StrQ{
+			`select $1, :one, :cond, :p3`,
+			ArgDicts{List{10}, Dict{`one`: 20, `cond`: Eq{Ident(`two`), 30}, `p3`: 40}},
+		},
+	)
+
+	test(
+		NamedParamAt,
+		`select @p_foo, @p_foo_, @p3, @p_1`,
+		[]sql.NamedArg{
+			sql.Named(`p_foo`, 10),
+			sql.Named(`p_foo_`, 20),
+			sql.Named(`p3`, 30),
+			sql.Named(`p_1`, 40),
+		},
+		StrQ{
+			`select :_foo, :p_foo, $1, :_1`,
+			ArgDicts{List{30}, Dict{`_foo`: 10, `p_foo`: 20, `_1`: 40}},
+		},
+	)
+
+	test(
+		NamedParamDollar,
+		`insert into some_table ("one", "two") values ($p1, $p2) returning $id`,
+		[]sql.NamedArg{sql.Named(`p1`, 10), sql.Named(`p2`, 20), sql.Named(`id`, 30)},
+		StrQ{
+			`insert into some_table :vals returning :id`,
+			Dict{`vals`: StructInsert{PairStruct{10, 20}}, `id`: 30},
+		},
+	)
+}
+
+func TestReifyNamed(t *testing.T) {
+	text, args := ReifyNamed(
+		NamedParamAt,
+		Select{`some_table`, Eq{Ident(`one`), 10}},
+		StrQ{`and :two`, Dict{`two`: 20}},
+	)
+
+	eq(t, `select * from "some_table" where ("one") = @p1 and @p2`, text)
+	eq(t, []sql.NamedArg{sql.Named(`p1`, 10), sql.Named(`p2`, 20)}, args)
+}
+
 func TestListQ_invalid(t *testing.T) {
 	panics(t, `non-parametrized expression "" expected no arguments`, func() {
 		ListQ(``, nil).AppendExpr(nil, nil)
@@ -1696,21 +1979,21 @@ func TestPreparse(t *testing.T) {
 
 func testPrepParse(t testing.TB, test func(string, []Token, bool)) {
 	test(``, nil, false)
-	test(`one`, []Token{Token{`one`, TokenTypeText}}, false)
-	test(`$1`, []Token{Token{`$1`, TokenTypeOrdinalParam}}, true)
-	test(`:one`, []Token{Token{`:one`, TokenTypeNamedParam}}, true)
+	test(`one`, []Token{Token{`one`, TokenTypeText, TokenPos{0, 1, 1}}}, false)
+	test(`$1`, []Token{Token{`$1`, TokenTypeOrdinalParam, TokenPos{0, 1, 1}}}, true)
+	test(`:one`, []Token{Token{`:one`, TokenTypeNamedParam, TokenPos{0, 1, 1}}}, true)
 
 	test(
 		`one $1 two :three four $2 five :six`,
 		[]Token{
-			Token{`one `, TokenTypeText},
-			Token{`$1`, TokenTypeOrdinalParam},
-			Token{` two `, TokenTypeText},
-			Token{`:three`, TokenTypeNamedParam},
-			Token{` four `, TokenTypeText},
-			Token{`$2`, TokenTypeOrdinalParam},
-			Token{` five `, TokenTypeText},
-			Token{`:six`, TokenTypeNamedParam},
+			Token{`one `, TokenTypeText, TokenPos{0, 1, 1}},
+			Token{`$1`, TokenTypeOrdinalParam, TokenPos{4, 1, 5}},
+			Token{` two `, TokenTypeText, TokenPos{6, 1, 7}},
+			Token{`:three`, TokenTypeNamedParam, TokenPos{11, 1, 12}},
+			Token{` four `, TokenTypeText, TokenPos{17, 1, 18}},
+			Token{`$2`, TokenTypeOrdinalParam, TokenPos{23, 1, 24}},
+			Token{` five `, TokenTypeText, TokenPos{25, 1, 26}},
+			Token{`:six`, TokenTypeNamedParam, TokenPos{31, 1, 32}},
 		},
 		true,
 	)
@@ -1724,100 +2007,919 @@ one
 three
 `,
 		[]Token{
-			Token{`one `, TokenTypeText},
-			Token{`:two`, TokenTypeNamedParam},
-			Token{`  three`, TokenTypeText},
+			Token{`one `, TokenTypeText, TokenPos{1, 2, 1}},
+			Token{`:two`, TokenTypeNamedParam, TokenPos{29, 4, 1}},
+			Token{`  three`, TokenTypeText, TokenPos{33, 4, 5}},
+		},
+		true,
+	)
+
+	test(
+		/*pgsql*/ `
+one
+/* outer $1 /* inner :one */ still comment :two */
+:three
+`,
+		[]Token{
+			Token{`one  `, TokenTypeText, TokenPos{1, 2, 1}},
+			Token{`:three`, TokenTypeNamedParam, TokenPos{56, 4, 1}},
+		},
+		true,
+	)
+
+	test(
+		/*pgsql*/ `
+create function one() returns int language sql as $$ select $1::int + :two $$;
+create function two() returns int language sql as $body$ select '$$' || $1 $body$;
+`,
+		[]Token{
+			Token{
+				`create function one() returns int language sql as $$ select $1::int + :two $$; create function two() returns int language sql as $body$ select '$$' || $1 $body$;`,
+				TokenTypeText,
+				TokenPos{1, 2, 1},
+			},
+		},
+		false,
+	)
+
+	test(
+		`select E'one\' $1 :two', e'three'' :four' where five = :six`,
+		[]Token{
+			Token{`select E'one\' $1 :two', e'three'' :four' where five = `, TokenTypeText, TokenPos{0, 1, 1}},
+			Token{`:six`, TokenTypeNamedParam, TokenPos{55, 1, 56}},
+		},
+		true,
+	)
+
+	test(
+		`select one$two, three$ = $1`,
+		[]Token{
+			Token{`select one$two, three$ = `, TokenTypeText, TokenPos{0, 1, 1}},
+			Token{`$1`, TokenTypeOrdinalParam, TokenPos{25, 1, 26}},
 		},
 		true,
 	)
 }
 
-func TestPreparse_dedup(t *testing.T) {
-	test := func(val string) {
+func TestTokenizer(t *testing.T) {
+	test := func(src string, exp []Token) {
 		t.Helper()
 
-		eq(t, Preparse(val), Preparse(val))
-		sliceIs(t, prepCache.Get(val).Tokens, prepCache.Get(val).Tokens)
-
-		prep := Preparse(val)
+		var out []Token
+		tok := Tokenizer{Source: src}
+		for {
+			val := tok.Next()
+			if val.IsInvalid() {
+				break
+			}
+			out = append(out, val)
+		}
 
-		eq(t, prep, Preparse(val))
-		eq(t, prep, Preparse(val))
+		eq(t, exp, out)
 	}
 
-	test(``)
-	test(` `)
-	test(`one`)
-	test(`one two`)
-	test(`one :two`)
-	test(`one :two three`)
+	test(``, nil)
 
-	notEq(t, Preparse(``), Preparse(` `))
-	notEq(t, Preparse(``), Preparse(`one`))
-	notEq(t, Preparse(` `), Preparse(`one`))
+	test(`$$one$$`, []Token{{`$$one$$`, TokenTypeQuotedDollar, TokenPos{0, 1, 1}}})
+	test(`$$$1 :two$$`, []Token{{`$$$1 :two$$`, TokenTypeQuotedDollar, TokenPos{0, 1, 1}}})
+	test(`$one$ $$ $two$ $one$`, []Token{{`$one$ $$ $two$ $one$`, TokenTypeQuotedDollar, TokenPos{0, 1, 1}}})
+	test(`$_1$one$_1$`, []Token{{`$_1$one$_1$`, TokenTypeQuotedDollar, TokenPos{0, 1, 1}}})
+
+	test(`$1$`, []Token{
+		{`$1`, TokenTypeOrdinalParam, TokenPos{0, 1, 1}},
+		{`$`, TokenTypeText, TokenPos{2, 1, 3}},
+	})
+
+	test(`one$two$three`, []Token{{`one$two$three`, TokenTypeText, TokenPos{0, 1, 1}}})
+
+	test(`one :`, []Token{
+		{`one`, TokenTypeText, TokenPos{0, 1, 1}},
+		{` `, TokenTypeWhitespace, TokenPos{3, 1, 4}},
+		{`:`, TokenTypeText, TokenPos{4, 1, 5}},
+	})
+
+	test(`:one.two_three.four :five.`, []Token{
+		{`:one.two_three.four`, TokenTypeNamedParam, TokenPos{0, 1, 1}},
+		{` `, TokenTypeWhitespace, TokenPos{19, 1, 20}},
+		{`:five`, TokenTypeNamedParam, TokenPos{20, 1, 21}},
+		{`.`, TokenTypeText, TokenPos{25, 1, 26}},
+	})
+
+	test(`:one.2 :one..two`, []Token{
+		{`:one`, TokenTypeNamedParam, TokenPos{0, 1, 1}},
+		{`.2`, TokenTypeText, TokenPos{4, 1, 5}},
+		{` `, TokenTypeWhitespace, TokenPos{6, 1, 7}},
+		{`:one`, TokenTypeNamedParam, TokenPos{7, 1, 8}},
+		{`..two`, TokenTypeText, TokenPos{11, 1, 12}},
+	})
+
+	test(`one $$two$$three`, []Token{
+		{`one`, TokenTypeText, TokenPos{0, 1, 1}},
+		{` `, TokenTypeWhitespace, TokenPos{3, 1, 4}},
+		{`$$two$$`, TokenTypeQuotedDollar, TokenPos{4, 1, 5}},
+		{`three`, TokenTypeText, TokenPos{11, 1, 12}},
+	})
+
+	test(`E'one'`, []Token{{`E'one'`, TokenTypeQuotedEscape, TokenPos{0, 1, 1}}})
+	test(`e'one\'two'`, []Token{{`e'one\'two'`, TokenTypeQuotedEscape, TokenPos{0, 1, 1}}})
+	test(`E'one''two'`, []Token{{`E'one''two'`, TokenTypeQuotedEscape, TokenPos{0, 1, 1}}})
+	test(`E'one\\'`, []Token{{`E'one\\'`, TokenTypeQuotedEscape, TokenPos{0, 1, 1}}})
+
+	test(`one'two'`, []Token{
+		{`one`, TokenTypeText, TokenPos{0, 1, 1}},
+		{`'two'`, TokenTypeQuotedSingle, TokenPos{3, 1, 4}},
+	})
+
+	test(`onee'two'`, []Token{
+		{`onee`, TokenTypeText, TokenPos{0, 1, 1}},
+		{`'two'`, TokenTypeQuotedSingle, TokenPos{4, 1, 5}},
+	})
+
+	test(`/* one /* two */ three */four`, []Token{
+		{`/* one /* two */ three */`, TokenTypeCommentBlock, TokenPos{0, 1, 1}},
+		{`four`, TokenTypeText, TokenPos{25, 1, 26}},
+	})
+
+	test(`/* one */ */`, []Token{
+		{`/* one */`, TokenTypeCommentBlock, TokenPos{0, 1, 1}},
+		{` `, TokenTypeWhitespace, TokenPos{9, 1, 10}},
+		{`*/`, TokenTypeText, TokenPos{10, 1, 11}},
+	})
 }
 
-/*
-Note: parametrized expression building is verified in various tests for `StrQ`,
-which uses a `Prep` internally. This is mostly for verifying the automatic
-"unparam" mode and associated assertions.
-*/
-func TestPrep_AppendParamExpr_unparam(t *testing.T) {
-	test := func(exp R, vals ...string) {
+func TestTokenizer_invalid(t *testing.T) {
+	test := func(msg, src string) {
 		t.Helper()
-		eq(t, exp, reiFrom(reifyUnparamPreps(vals...)))
+		panics(t, msg, func() {
+			tok := Tokenizer{Source: src}
+			for !tok.Next().IsInvalid() {
+			}
+		})
 	}
 
-	test(rei(``))
-	test(rei(``), ``)
-	test(rei(``), ``, ``)
-	test(rei(`one`), `one`)
-	test(rei(`one`), ``, `one`, ``)
-	test(rei(`one two`), ``, `one`, ``, `two`, ``)
+	test(`expected closing "$$", got unexpected EOF`, `$$one`)
+	test(`expected closing "$one$", got unexpected EOF`, `$one$ two $$`)
+	test(`expected closing '\'', got unexpected EOF`, `E'one\'`)
+	test(`expected closing "*/", got unexpected EOF`, `/* one /* two */`)
+}
 
-	testNilArgs := func(val string) {
+func TestTokenizer_position(t *testing.T) {
+	test := func(src string, exp []TokenPos) {
 		t.Helper()
-		eq(t, rei(val), reifyParamExpr(Preparse(val), nil))
-		eq(t, rei(val), reifyParamExpr(Preparse(val), Dict(nil)))
-		eq(t, rei(val), reifyParamExpr(Preparse(val), (*Dict)(nil)))
-		eq(t, rei(val), reifyParamExpr(Preparse(val), (*StructDict)(nil)))
+
+		var out []TokenPos
+		tok := Tokenizer{Source: src}
+		for {
+			val := tok.Next()
+			if val.IsInvalid() {
+				break
+			}
+			out = append(out, val.Pos)
+		}
+
+		eq(t, exp, out)
 	}
 
-	testNilArgs(``)
-	testNilArgs(`one`)
-	testNilArgs(`one two`)
+	test("one\ntwo", []TokenPos{{0, 1, 1}, {3, 1, 4}, {4, 2, 1}})
+	test("one\r\ntwo", []TokenPos{{0, 1, 1}, {3, 1, 4}, {5, 2, 1}})
+	test("one\rtwo", []TokenPos{{0, 1, 1}, {3, 1, 4}, {4, 2, 1}})
+	test("\n\n\r\r\n:one", []TokenPos{{0, 1, 1}, {5, 5, 1}})
+	test("'ü\nü' $1", []TokenPos{{0, 1, 1}, {7, 2, 3}, {8, 2, 4}})
+	test("/* ü\n */$1", []TokenPos{{0, 1, 1}, {9, 2, 4}})
+
+	eq(t, `unknown position`, TokenPos{}.String())
+	eq(t, `line 2, column 3`, TokenPos{5, 2, 3}.String())
+}
+
+func TestReaderTokenizer(t *testing.T) {
+	tokenize := func(src string) (out []Token) {
+		tok := Tokenizer{Source: src}
+		for {
+			val := tok.Next()
+			if val.IsInvalid() {
+				return
+			}
+			out = append(out, val)
+		}
+	}
 
-	testPanic := func(val string) {
+	readAll := func(tok ReaderTokenizer) (out []Token) {
+		for {
+			val, err := tok.Next()
+			try(err)
+			if val.IsInvalid() {
+				return
+			}
+			out = append(out, val)
+		}
+	}
+
+	test := func(src string) {
 		t.Helper()
+		exp := tokenize(src)
 
-		prep := Preparse(val)
-		msg := fmt.Sprintf(`non-parametrized expression %q expected no arguments, got`, val)
+		eq(t, exp, readAll(ReaderTokenizer{Reader: strings.NewReader(src)}))
+		eq(t, exp, readAll(ReaderTokenizer{Reader: iotest.OneByteReader(strings.NewReader(src))}))
+		eq(t, exp, readAll(ReaderTokenizer{Reader: iotest.HalfReader(strings.NewReader(src)), ChunkSize: 3}))
+	}
 
-		panics(t, msg, func() {
-			prep.AppendParamExpr(nil, nil, Dict{})
+	test(``)
+	test(`one`)
+	test(`one two  three`)
+	test(`one $1 two :three four $2 five :six::seven`)
+	test("one\r\n-- comment $1\r\n/* one /* two */ three */ four\n\r")
+	test(`select 'one' "two" ` + "`three`" + ` E'four\' five' e'six''seven'`)
+	test(`$$one$$ $tag$ $1 :two $tag$ one$two $1$ :three`)
+	test(`E'one' onee'two' /* ü */ 'ü'`)
+	test(`select :one; select 'two;'; select 3`)
+	test(`select :one.two, :three.four.five, :six.`)
+
+	t.Run(`Transform`, func(t *testing.T) {
+		src := "one /* two */ three\n-- four\n:five"
+		out := readAll(ReaderTokenizer{
+			Reader:    iotest.OneByteReader(strings.NewReader(src)),
+			Transform: trimWhitespaceAndComments,
 		})
 
-		panics(t, msg, func() {
-			prep.AppendParamExpr(nil, nil, StructDict{})
-		})
-	}
+		eq(
+			t,
+			[]Token{
+				{`one`, TokenTypeText, TokenPos{0, 1, 1}},
+				{` `, TokenTypeWhitespace, TokenPos{3, 1, 4}},
+				{` `, TokenTypeWhitespace, TokenPos{13, 1, 14}},
+				{`three`, TokenTypeText, TokenPos{14, 1, 15}},
+				{` `, TokenTypeWhitespace, TokenPos{19, 1, 20}},
+				{`:five`, TokenTypeNamedParam, TokenPos{28, 3, 1}},
+			},
+			out,
+		)
+	})
 
-	testPanic(``)
-	testPanic(`one`)
-	testPanic(`one two`)
+	t.Run(`bounded buffer`, func(t *testing.T) {
+		src := strings.Repeat(`select 'one', :two; `, 1024)
+		tok := ReaderTokenizer{Reader: strings.NewReader(src), ChunkSize: 64}
+		eq(t, tokenize(src), readAll(tok))
+
+		for {
+			val, err := tok.Next()
+			try(err)
+			if val.IsInvalid() {
+				break
+			}
+		}
+		eq(t, true, cap(tok.buf) <= 64)
+	})
 }
 
-func Test_combinations(t *testing.T) {
-	testExpr(
-		t,
-		rei(`($1 or $2) = ($3 or $4)`, 10, 20, 30, 40),
-		Eq{Ors{10, 20}, Ors{30, 40}},
-	)
+/*
+Short reads must not cause the pending token to be rescanned after every read,
+which would take quadratic time for large tokens.
+*/
+func TestReaderTokenizer_short_reads(t *testing.T) {
+	body := strings.Repeat(`one two `, 1<<17)
 
-	testExpr(
-		t,
-		rei(`($1 or $2) and ($3 or $4) and $5`, 10, 20, 30, 40, 50),
-		Ands{Ors{10, 20}, Ors{30, 40}, 50},
+	test := func(src string) {
+		t.Helper()
+		exp := (&Tokenizer{Source: src}).Next()
+		tok := ReaderTokenizer{Reader: iotest.OneByteReader(strings.NewReader(src))}
+
+		val, err := tok.Next()
+		try(err)
+		eq(t, exp.Type, val.Type)
+		eq(t, true, exp == val)
+
+		val, err = tok.Next()
+		try(err)
+		eq(t, true, val.IsInvalid())
+	}
+
+	test(`$$` + body + `$$`)
+	test(`'` + body + `'`)
+	test(`/*` + body + `*/`)
+}
+
+func TestReaderTokenizer_invalid(t *testing.T) {
+	test := func(msg string, tok ReaderTokenizer) {
+		t.Helper()
+		panics(t, msg, func() {
+			for {
+				val, err := tok.Next()
+				try(err)
+				if val.IsInvalid() {
+					return
+				}
+			}
+		})
+	}
+
+	test(`expected closing '\'', got unexpected EOF`, ReaderTokenizer{
+		Reader: iotest.OneByteReader(strings.NewReader(`one 'two`)),
+	})
+
+	test(`expected closing "*/", got unexpected EOF`, ReaderTokenizer{
+		Reader: iotest.OneByteReader(strings.NewReader(`one /* two /* three */`)),
+	})
+
+	test(`token at line 2, column 5 exceeds the limit of 8 bytes`, ReaderTokenizer{
+		Reader:       iotest.OneByteReader(strings.NewReader("one\ntwo 'three four'")),
+		MaxTokenSize: 8,
+	})
+
+	test(`error while reading SQL: some error`, ReaderTokenizer{
+		Reader: io.MultiReader(strings.NewReader(`one two`), iotest.ErrReader(errors.New(`some error`))),
+	})
+}
+
+func TestSplitScript(t *testing.T) {
+	test := func(src string, exp []Stmt) {
+		t.Helper()
+		out, err := SplitScript(src)
+		try(err)
+		eq(t, exp, out)
+	}
+
+	test(``, nil)
+	test(`  ;; ; -- comment`, nil)
+	test(`one`, []Stmt{{`one`, TokenPos{0, 1, 1}}})
+	test(`one;`, []Stmt{{`one`, TokenPos{0, 1, 1}}})
+	test(`one;two`, []Stmt{{`one`, TokenPos{0, 1, 1}}, {`two`, TokenPos{4, 1, 5}}})
+	test(`one ; ; two ;`, []Stmt{{`one`, TokenPos{0, 1, 1}}, {`two`, TokenPos{8, 1, 9}}})
+
+	test(
+		"-- leading comment\nselect 1; -- trailing comment\n/* block */ select /* inner; */ 2\n;\n",
+		[]Stmt{
+			{`select 1`, TokenPos{19, 2, 1}},
+			{`select /* inner; */ 2`, TokenPos{61, 3, 13}},
+		},
+	)
+
+	test(
+		`select ';', ";", E'\';', $$;$$, $tag$ ; $tag$; select 2`,
+		[]Stmt{
+			{`select ';', ";", E'\';', $$;$$, $tag$ ; $tag$`, TokenPos{0, 1, 1}},
+			{`select 2`, TokenPos{47, 1, 48}},
+		},
+	)
+
+	test(
+		`begin; insert into one values (1); commit;`,
+		[]Stmt{
+			{`begin`, TokenPos{0, 1, 1}},
+			{`insert into one values (1)`, TokenPos{7, 1, 8}},
+			{`commit`, TokenPos{35, 1, 36}},
+		},
+	)
+
+	test(
+		`begin transaction; end; BEGIN WORK; begin isolation level serializable; begin`,
+		[]Stmt{
+			{`begin transaction`, TokenPos{0, 1, 1}},
+			{`end`, TokenPos{19, 1, 20}},
+			{`BEGIN WORK`, TokenPos{24, 1, 25}},
+			{`begin isolation level serializable`, TokenPos{36, 1, 37}},
+			{`begin`, TokenPos{72, 1, 73}},
+		},
+	)
+
+	test(
+		`create function one() returns int begin atomic select 1; select case when true then 2 end; end; select 3`,
+		[]Stmt{
+			{`create function one() returns int begin atomic select 1; select case when true then 2 end; end`, TokenPos{0, 1, 1}},
+			{`select 3`, TokenPos{96, 1, 97}},
+		},
+	)
+
+	test(
+		`create trigger one after insert on two BEGIN insert into three values (new.end); END; select 4`,
+		[]Stmt{
+			{`create trigger one after insert on two BEGIN insert into three values (new.end); END`, TokenPos{0, 1, 1}},
+			{`select 4`, TokenPos{86, 1, 87}},
+		},
+	)
+
+	test(
+		`create procedure one() begin if true then select 1; end if; begin select 2; end; end; select 5`,
+		[]Stmt{
+			{`create procedure one() begin if true then select 1; end if; begin select 2; end; end`, TokenPos{0, 1, 1}},
+			{`select 5`, TokenPos{86, 1, 87}},
+		},
+	)
+
+	test(
+		`select begin_date, "begin" from one; select 6`,
+		[]Stmt{
+			{`select begin_date, "begin" from one`, TokenPos{0, 1, 1}},
+			{`select 6`, TokenPos{37, 1, 38}},
+		},
+	)
+
+	test(
+		"select :one;\r\nselect $1",
+		[]Stmt{
+			{`select :one`, TokenPos{0, 1, 1}},
+			{`select $1`, TokenPos{14, 2, 1}},
+		},
+	)
+}
+
+func TestSplitScript_invalid(t *testing.T) {
+	test := func(msg, src string) {
+		t.Helper()
+		panics(t, msg, func() { try1(SplitScript(src)) })
+	}
+
+	test(`expected closing '\'', got unexpected EOF`, `select 1; select 'two`)
+	test(`expected closing "$$", got unexpected EOF`, `select $$two`)
+	test(`expected closing "*/", got unexpected EOF`, `select 1 /* two`)
+}
+
+func TestStmt(t *testing.T) {
+	stmt := Stmt{`select :one`, TokenPos{10, 2, 1}}
+	testExpr(t, rei(`select :one`), stmt)
+
+	eq(
+		t,
+		Prep{
+			Source: `select :one`,
+			Tokens: []Token{
+				{`select `, TokenTypeText, TokenPos{0, 1, 1}},
+				{`:one`, TokenTypeNamedParam, TokenPos{7, 1, 8}},
+			},
+			HasParams: true,
+		},
+		stmt.Prep(),
+	)
+
+	testExpr(t, rei(`select $1`, 10), StrQ{stmt.Text, Dict{`one`: 10}})
+}
+
+func TestMinify(t *testing.T) {
+	test := func(exp, src string) {
+		t.Helper()
+		eq(t, exp, Minify(src))
+	}
+
+	test(``, ``)
+	test(``, " \n\t -- comment\n /* comment */ ")
+	test(`one`, `one`)
+	test(`one two`, "\n\tone\n\t\ttwo\n")
+	test(`one two`, `one/* comment */two`)
+	test(`one two`, "one-- comment\ntwo")
+	test(`one = $1 and two = :two`, "one   =   $1\nand two = :two -- trailing")
+	test(`select 'one  -- two', "three  /* four */", $$ five  six $$, E'seven  \'  eight'`, "select 'one  -- two',\n\t\"three  /* four */\",\n\t$$ five  six $$,\n\tE'seven  \\'  eight'")
+	test(`one::text`, `one::text`)
+
+	panics(t, `expected closing '\'', got unexpected EOF`, func() {
+		Minify(`select 'one`)
+	})
+}
+
+func TestPrettify(t *testing.T) {
+	test := func(exp, src string) {
+		t.Helper()
+		eq(t, exp, Prettify(src))
+	}
+
+	test(``, ``)
+	test(`one`, "\n\tone\n")
+
+	test(
+		`select *
+from one
+where two = $1
+order by three desc
+limit 10`,
+		"\n\tselect * from one\n\t-- comment\n\twhere two = $1 order by three desc limit 10\n",
+	)
+
+	test(
+		`select *
+from (
+	select one
+	from two
+	where three in (
+		select four
+		from five
+	)
+) as six
+left join seven on six.one = seven.one
+where eight = 'select from where'`,
+		`select * from (select one from two where three in (select four from five)) as six left join seven on six.one = seven.one where eight = 'select from where'`,
+	)
+
+	test(
+		`select left(one, 1), count(*) over (partition by two order by three)
+from four
+where five is distinct from six for update`,
+		`select left(one, 1), count(*) over (partition by two order by three) from four where five is distinct from six for update`,
+	)
+
+	test(
+		`with one as (
+	select 1
+)
+select *
+from one
+union all
+select 2`,
+		`with one as (select 1) select * from one union all select 2`,
+	)
+
+	test(
+		`insert into one (two, three)
+values ($1, $2)
+on conflict (two) do update
+set three = excluded.three
+returning *`,
+		`insert into one (two, three) values ($1, $2) on conflict (two) do update set three = excluded.three returning *`,
+	)
+
+	test(
+		`DELETE FROM one
+WHERE two IN (
+	SELECT three
+	FROM four
+)`,
+		`DELETE FROM one WHERE two IN (SELECT three FROM four)`,
+	)
+}
+
+func TestFormatter_Indent(t *testing.T) {
+	eq(
+		t,
+		"select *\nfrom (\n  select one\n  from two\n) as three",
+		Formatter{Pretty: true, Indent: `  `}.Format(`select * from (select one from two) as three`),
+	)
+
+	eq(
+		t,
+		`prefix: select one`,
+		string(Formatter{}.Append([]byte(`prefix: `), " select\n\tone ")),
+	)
+}
+
+func TestFingerprintText(t *testing.T) {
+	test := func(exp, src string) {
+		t.Helper()
+		out := FingerprintText(src)
+		eq(t, exp, out.Text)
+		eq(t, FingerprintText(exp).Hash, out.Hash)
+	}
+
+	test(``, ``)
+	test(`select ?`, `select 1`)
+	test(`select ?`, ` SELECT  12.5e3 -- comment`)
+	test(`select ?, ?, ?, ?, ?`, `select 'one', E'two', $$three$$, $1, :four`)
+	test(`select "One", ` + "`Two`", `SELECT "One", ` + "`Two`")
+	test(`select count(*) from one`, "select count (*)\n/* comment */ from One")
+	test(`select one.two::text from one`, `select one . two :: text from one`)
+	test(`where one >= ? and two <> ?`, `where one>=10 and two<>:two`)
+	test(`where one in(?) and two not in(?)`, `where one in (1, 2, 3) and two not in ($1)`)
+	test(`where one in(two, ?)`, `where one in (two, 3)`)
+	test(`where one in(select ?)`, `where one in (select 1)`)
+	test(`values(?, ?)`, `values ($1, $2), ($3, $4), ($5, $6)`)
+	test(`values(?, default)`, `values ($1, default), ($2, default)`)
+	test(`values(?, default), (?, ?)`, `values ($1, default), ($2, $3)`)
+	test(`select f((?)), g(?, ?)`, `select f((1), (2), (3)), g(1, 2)`)
+	test(`select ?; select ?`, `select 1; select 2;`)
+	test(`where one = ? and two = ?`, `where one = -1 and two = 2`)
+	test(`where one = ? and two = ?`, `where one=-1.5 and two = - 2`)
+	test(`select ?, (?), f(?), one - ?, one - ?`, `select -1, (-2), f(-3), one - 4, one -5`)
+	test(`select ? - ?, ? - ?, ? - ?`, `select 1 - 2, $1-2, 'one' - -3`)
+	test(`select one - ?, one - ?`, `select one - -1, one- -2`)
+	test(`where one between ? and ? limit ?`, `where one between -1 and -2 limit -3`)
+	test(`select - one, - ?`, `select -one, -$1`)
+
+	eq(t, `select ?`, FingerprintText(`select 'one;'`).Text)
+	notEq(t, FingerprintText(`select one`).Hash, FingerprintText(`select two`).Hash)
+	eq(t, FingerprintText(`select * from one where two = 1`), FingerprintText(`select * from one where two = -1`))
+	eq(t, 16, len(FingerprintText(`select one`).String()))
+}
+
+func TestFingerprintOf(t *testing.T) {
+	rows := func(count int) (out StructsInsert[PairStruct]) {
+		for ind := 0; ind < count; ind++ {
+			out = append(out, PairStruct{ind, ind})
+		}
+		return
+	}
+
+	test := func(count int) Fingerprint {
+		return FingerprintOf(Exprs{
+			Str(`insert into some_table`),
+			rows(count),
+			Str(`returning *`),
+		})
+	}
+
+	exp := test(1)
+	eq(t, `insert into some_table("one", "two") values(?, ?) returning *`, exp.Text)
+	eq(t, exp, test(10))
+	eq(t, exp, test(1000))
+}
+
+type debugValuer [1]any
+
+func (self debugValuer) Value() (driver.Value, error) {
+	err, _ := self[0].(error)
+	if err != nil {
+		return nil, err
+	}
+	return self[0], nil
+}
+
+type debugNullable bool
+
+type debugBytes []byte
+
+func (self debugNullable) IsNull() bool { return bool(self) }
+
+func TestInlineArgs(t *testing.T) {
+	test := func(exp, text string, args ...any) {
+		t.Helper()
+		eq(t, DebugMarker+exp, InlineArgs(text, args))
+	}
+
+	test(``, ``)
+	test(`one`, `one`)
+	test(`$1`, `$1`)
+	test(`null`, `$1`, nil)
+	test(`null`, `$1`, (*int)(nil))
+	test(`null`, `$1`, debugNullable(true))
+	test(`false`, `$1`, debugNullable(false))
+	test(`true, false`, `$1, $2`, true, false)
+	test(`10, (-20), 30`, `$1, $2, $3`, 10, int8(-20), uint64(30))
+	test(`1.5, (-2.5), 'NaN', 'Infinity', '-Infinity'`, `$1, $2, $3, $4, $5`, 1.5, float32(-2.5), math.NaN(), math.Inf(1), math.Inf(-1))
+	test(`'one', 'two''three', 'four\five'`, `$1, $2, $3`, `one`, `two'three`, `four\five`)
+	test(`'\x0aff', '\x'`, `$1, $2`, []byte{0x0a, 0xff}, []byte{})
+	test(`'\x7b7d'`, `$1`, debugBytes(`{}`))
+	test(`'2024-01-02T03:04:05.5Z'`, `$1`, time.Date(2024, 1, 2, 3, 4, 5, 5e8, time.UTC))
+	test(`'{10,20}'`, `$1`, ArrayAppender[Stringer]{Stringer{10}, Stringer{20}})
+	test(`'one'`, `$1`, debugValuer{`one`})
+	test(`10`, `$1`, debugValuer{int64(10)})
+	test(`null`, `$1`, debugValuer{nil})
+	test(`null /* "some * / error" */`, `$1`, debugValuer{errors.New(`some */ error`)})
+	test(`10`, `$1`, &[]int{10}[0])
+	test(`'[10 20]'`, `$1`, []int{10, 20})
+	test(`'one' = 'one', $2`, `$1 = $1, $2`, `one`)
+	test(`x - (-1)`, `x - $1`, -1)
+	test(`'$1' "$1" -- $1
+10`, "'$1' \"$1\" -- $1\n$1", 10)
+}
+
+func TestReifyDebug(t *testing.T) {
+	eq(
+		t,
+		DebugMarker+`select * from "persons" where (("id") = 10) and (("name") = 'Alice')`,
+		ReifyDebug(
+			Select{`persons`, Ands{Eq{Ident(`id`), 10}, Eq{Ident(`name`), `Alice`}}},
+		),
+	)
+
+	var bui Bui
+	bui.Str(`select`)
+	bui.Arg(`one`)
+	eq(t, DebugMarker+`select 'one'`, bui.ReifyDebug())
+}
+
+func TestVerbose(t *testing.T) {
+	expr := Eq{Ident(`name`), `Alice`}
+	eq(t, `("name") = $1`, expr.String())
+
+	eq(t, DebugMarker+`("name") = 'Alice'`, Verbose{expr}.String())
+	eq(t, DebugMarker+`("name") = 'Alice'`, fmt.Sprint(Verbose{expr}))
+	eq(t, `("name") = $1`, expr.String())
+
+	eq(t, rei(`("name") = $1`, `Alice`), reify(Verbose{expr}))
+	eq(t, rei(``), reify(Verbose{}))
+	eq(t, DebugMarker, Verbose{}.String())
+}
+
+func TestPreparse_dedup(t *testing.T) {
+	test := func(val string) {
+		t.Helper()
+
+		eq(t, Preparse(val), Preparse(val))
+		sliceIs(t, Preparse(val).Tokens, Preparse(val).Tokens)
+
+		prep := Preparse(val)
+
+		eq(t, prep, Preparse(val))
+		eq(t, prep, Preparse(val))
+	}
+
+	test(``)
+	test(` `)
+	test(`one`)
+	test(`one two`)
+	test(`one :two`)
+	test(`one :two three`)
+
+	notEq(t, Preparse(``), Preparse(` `))
+	notEq(t, Preparse(``), Preparse(`one`))
+	notEq(t, Preparse(` `), Preparse(`one`))
+}
+
+func TestPrepCacheLru(t *testing.T) {
+	cache := NewPrepCacheLru(2)
+	eq(t, 0, cache.Len())
+
+	_, ok := cache.Get(`one`)
+	eq(t, false, ok)
+
+	cache.Set(`one`, Prep{Source: `one`})
+	cache.Set(`two`, Prep{Source: `two`})
+	eq(t, 2, cache.Len())
+	eq(t, uint64(0), cache.Evictions())
+
+	// Marks "one" as recently used, making "two" the eviction candidate.
+	val, ok := cache.Get(`one`)
+	eq(t, true, ok)
+	eq(t, Prep{Source: `one`}, val)
+
+	cache.Set(`three`, Prep{Source: `three`})
+	eq(t, 2, cache.Len())
+	eq(t, uint64(1), cache.Evictions())
+
+	_, ok = cache.Get(`two`)
+	eq(t, false, ok)
+	_, ok = cache.Get(`one`)
+	eq(t, true, ok)
+	_, ok = cache.Get(`three`)
+	eq(t, true, ok)
+
+	cache.Set(`three`, Prep{Source: `three`, HasParams: true})
+	eq(t, 2, cache.Len())
+	eq(t, uint64(1), cache.Evictions())
+
+	val, _ = cache.Get(`three`)
+	eq(t, Prep{Source: `three`, HasParams: true}, val)
+
+	eq(t, 0, NewPrepCacheLru(0).Len())
+	NewPrepCacheLru(0).Set(`one`, Prep{})
+}
+
+func TestSetPrepCache(t *testing.T) {
+	defer SetPrepCache(GetPrepCache())
+	defer EnablePrepCacheStats(EnablePrepCacheStats(true))
+
+	t.Run(`lru`, func(t *testing.T) {
+		cache := NewPrepCacheLru(1)
+		SetPrepCache(cache)
+		ResetPrepCacheStats()
+
+		eq(t, Preparse(`one :two`), Preparse(`one :two`))
+		eq(t, PrepStats{Hits: 1, Misses: 1}, PrepCacheStats())
+
+		Preparse(`three`)
+		eq(t, PrepStats{Hits: 1, Misses: 2}, PrepCacheStats())
+		eq(t, 1, cache.Len())
+		eq(t, uint64(1), cache.Evictions())
+
+		Preparse(`one :two`)
+		eq(t, PrepStats{Hits: 1, Misses: 3}, PrepCacheStats())
+
+		ResetPrepCacheStats()
+		eq(t, PrepStats{}, PrepCacheStats())
+	})
+
+	t.Run(`disabled`, func(t *testing.T) {
+		SetPrepCache(nil)
+		eq(t, nil, GetPrepCache())
+		ResetPrepCacheStats()
+
+		eq(t, Preparse(`one :two`), Preparse(`one :two`))
+		eq(t, PrepStats{Misses: 2}, PrepCacheStats())
+
+		eq(t, nil, WarmPrepCache(`'unclosed`))
+	})
+
+	t.Run(`custom`, func(t *testing.T) {
+		cache := &testPrepCache{}
+		prev := SetPrepCache(cache)
+		eq(t, nil, prev)
+		eq(t, true, GetPrepCache() == PrepCacher(cache))
+		ResetPrepCacheStats()
+
+		Preparse(`one`)
+		Preparse(`one`)
+		Preparse(`two`)
+
+		eq(t, []string{`one`, `one`, `two`}, cache.gets)
+		eq(t, []string{`one`, `two`}, cache.sets)
+		eq(t, PrepStats{Hits: 1, Misses: 2}, PrepCacheStats())
+	})
+
+	t.Run(`stats_disabled`, func(t *testing.T) {
+		SetPrepCache(NewPrepCacheLru(8))
+		ResetPrepCacheStats()
+
+		eq(t, true, EnablePrepCacheStats(false))
+		Preparse(`one`)
+		Preparse(`one`)
+		eq(t, PrepStats{}, PrepCacheStats())
+
+		eq(t, false, EnablePrepCacheStats(true))
+		Preparse(`one`)
+		eq(t, PrepStats{Hits: 1}, PrepCacheStats())
+	})
+
+	t.Run(`warm`, func(t *testing.T) {
+		cache := NewPrepCacheLru(8)
+		SetPrepCache(cache)
+		ResetPrepCacheStats()
+
+		eq(t, nil, WarmPrepCache(`one`, `two :three`, `one`))
+		eq(t, 2, cache.Len())
+		eq(t, PrepStats{}, PrepCacheStats())
+
+		Preparse(`two :three`)
+		eq(t, PrepStats{Hits: 1}, PrepCacheStats())
+
+		panics(t, `expected closing`, func() {
+			try(WarmPrepCache(`four`, `'unclosed`))
+		})
+		eq(t, 3, cache.Len())
+	})
+}
+
+type testPrepCache struct {
+	PrepCacheMap
+	gets []string
+	sets []string
+}
+
+func (self *testPrepCache) Get(src string) (Prep, bool) {
+	self.gets = append(self.gets, src)
+	return self.PrepCacheMap.Get(src)
+}
+
+func (self *testPrepCache) Set(src string, val Prep) {
+	self.sets = append(self.sets, src)
+	self.PrepCacheMap.Set(src, val)
+}
+
+/*
+Note: parametrized expression building is verified in various tests for `StrQ`,
+which uses a `Prep` internally. This is mostly for verifying the automatic
+"unparam" mode and associated assertions.
+*/
+func TestPrep_AppendParamExpr_unparam(t *testing.T) {
+	test := func(exp R, vals ...string) {
+		t.Helper()
+		eq(t, exp, reiFrom(reifyUnparamPreps(vals...)))
+	}
+
+	test(rei(``))
+	test(rei(``), ``)
+	test(rei(``), ``, ``)
+	test(rei(`one`), `one`)
+	test(rei(`one`), ``, `one`, ``)
+	test(rei(`one two`), ``, `one`, ``, `two`, ``)
+
+	testNilArgs := func(val string) {
+		t.Helper()
+		eq(t, rei(val), reifyParamExpr(Preparse(val), nil))
+		eq(t, rei(val), reifyParamExpr(Preparse(val), Dict(nil)))
+		eq(t, rei(val), reifyParamExpr(Preparse(val), (*Dict)(nil)))
+		eq(t, rei(val), reifyParamExpr(Preparse(val), (*StructDict)(nil)))
+	}
+
+	testNilArgs(``)
+	testNilArgs(`one`)
+	testNilArgs(`one two`)
+
+	testPanic := func(val string) {
+		t.Helper()
+
+		prep := Preparse(val)
+		msg := fmt.Sprintf(`non-parametrized expression %q expected no arguments, got`, val)
+
+		panics(t, msg, func() {
+			prep.AppendParamExpr(nil, nil, Dict{})
+		})
+
+		panics(t, msg, func() {
+			prep.AppendParamExpr(nil, nil, StructDict{})
+		})
+	}
+
+	testPanic(``)
+	testPanic(`one`)
+	testPanic(`one two`)
+}
+
+func Test_combinations(t *testing.T) {
+	testExpr(
+		t,
+		rei(`($1 or $2) = ($3 or $4)`, 10, 20, 30, 40),
+		Eq{Ors{10, 20}, Ors{30, 40}},
+	)
+
+	testExpr(
+		t,
+		rei(`($1 or $2) and ($3 or $4) and $5`, 10, 20, 30, 40, 50),
+		Ands{Ors{10, 20}, Ors{30, 40}, 50},
 	)
 
 	testExpr(
@@ -1956,6 +3058,233 @@ func TestStructDict(t *testing.T) {
 	testArgDictNamed(t, zero, empty, full)
 }
 
+type PathDictFilter struct {
+	MinAge int64  `db:"min_age" json:"minAge"`
+	MaxAge *int64 `db:"max_age" json:"maxAge"`
+	Name   string `json:"-"`
+}
+
+type PathDictArgs struct {
+	*PathDictFilter
+	Filter PathDictFilter `db:"filter" json:"filter"`
+	Ptr    *PathDictArgs  `db:"ptr" json:"ptr,omitempty"`
+	Extra  map[string]any `db:"extra"`
+}
+
+func TestPathDict(t *testing.T) {
+	t.Run(`ArgDict`, func(t *testing.T) {
+		zero := PathDict{}
+		empty := PathDict{Val: Void{}}
+		full := PathDict{Val: benchStructDict.(StructDict)[0].Interface()}
+
+		eq(t, 0, zero.Len())
+		eq(t, 0, empty.Len())
+		eq(t, 0, full.Len())
+
+		testArgDictNamed(t, zero, empty, full)
+
+		eq(t, true, PathDict{Val: map[string]any{}}.IsEmpty())
+		eq(t, false, PathDict{Val: map[string]any{`one`: 10}}.IsEmpty())
+	})
+
+	args := &PathDictArgs{
+		Filter: PathDictFilter{MinAge: 10, Name: `one`},
+		Ptr:    &PathDictArgs{Filter: PathDictFilter{MinAge: 20}},
+		Extra:  map[string]any{`one`: map[string]any{`two`: 30}, `nil`: nil},
+	}
+
+	test := func(naming FieldNaming, key string, exp any) {
+		t.Helper()
+		val, ok := PathDict{args, naming}.GotNamed(key)
+		eq(t, true, ok)
+		eq(t, exp, val)
+	}
+
+	missing := func(naming FieldNaming, key string) {
+		t.Helper()
+		val, ok := PathDict{args, naming}.GotNamed(key)
+		eq(t, false, ok)
+		eq(t, nil, val)
+	}
+
+	t.Run(`go`, func(t *testing.T) {
+		test(FieldNamingGo, `Filter.MinAge`, int64(10))
+		test(FieldNamingGo, `Filter.MaxAge`, (*int64)(nil))
+		test(FieldNamingGo, `Filter.Name`, `one`)
+		test(FieldNamingGo, `Ptr.Filter.MinAge`, int64(20))
+		test(FieldNamingGo, `Ptr.Ptr.Filter.MinAge`, nil)
+		test(FieldNamingGo, `Extra.one.two`, 30)
+		test(FieldNamingGo, `Extra.nil.two`, nil)
+
+		// Promoted through a nil embedded pointer.
+		test(FieldNamingGo, `MinAge`, nil)
+
+		missing(FieldNamingGo, `filter.min_age`)
+		missing(FieldNamingGo, `Filter.Other`)
+		missing(FieldNamingGo, `Extra.two`)
+		missing(FieldNamingGo, `Filter.MinAge.Other`)
+	})
+
+	t.Run(`db`, func(t *testing.T) {
+		test(FieldNamingDb, `filter.min_age`, int64(10))
+		test(FieldNamingDb, `ptr.filter.min_age`, int64(20))
+		test(FieldNamingDb, `extra.one.two`, 30)
+		test(FieldNamingDb, `min_age`, nil)
+
+		missing(FieldNamingDb, `Filter.MinAge`)
+		missing(FieldNamingDb, `filter.Name`)
+		missing(FieldNamingDb, `filter.name`)
+	})
+
+	t.Run(`json`, func(t *testing.T) {
+		test(FieldNamingJson, `filter.minAge`, int64(10))
+		test(FieldNamingJson, `ptr.filter.minAge`, int64(20))
+		test(FieldNamingJson, `Extra.one.two`, 30)
+		test(FieldNamingJson, `minAge`, nil)
+
+		missing(FieldNamingJson, `filter.min_age`)
+		missing(FieldNamingJson, `filter.Name`)
+		missing(FieldNamingJson, `extra`)
+	})
+
+	t.Run(`RangeNamed`, func(t *testing.T) {
+		test := func(exp []string, dict PathDict) {
+			t.Helper()
+			var out []string
+			dict.RangeNamed(func(key string) { out = append(out, key) })
+			eq(t, exp, out)
+		}
+
+		test(nil, PathDict{})
+		test([]string{`MinAge`, `MaxAge`, `Name`, `Filter`, `Ptr`, `Extra`}, PathDict{args, FieldNamingGo})
+		test([]string{`min_age`, `max_age`, `filter`, `ptr`, `extra`}, PathDict{args, FieldNamingDb})
+		test([]string{`minAge`, `maxAge`, `filter`, `ptr`, `Extra`}, PathDict{args, FieldNamingJson})
+		test([]string{`one`}, PathDict{Val: map[string]any{`one`: 10}})
+	})
+
+	t.Run(`StrQ`, func(t *testing.T) {
+		dict := PathDict{
+			Val: struct {
+				Filter PathDictFilter `db:"filter"`
+				Limit  int            `db:"limit"`
+			}{Filter: PathDictFilter{MinAge: 10}, Limit: 20},
+			Naming: FieldNamingDb,
+		}
+
+		testExpr(
+			t,
+			rei(
+				`select * from persons where age >= $1 and (age <= $2 or $2 is null) and age <> $1 limit $3`,
+				int64(10), (*int64)(nil), 20,
+			),
+			StrQ{
+				`select * from persons where age >= :filter.min_age and (age <= :filter.max_age or :filter.max_age is null) and age <> :filter.min_age limit :limit`,
+				dict,
+			},
+		)
+
+		panics(t, `unused named argument ":limit"`, func() {
+			StrQ{`select :filter.min_age`, dict}.AppendExpr(nil, nil)
+		})
+
+		panics(t, `missing named argument ":filter.other"`, func() {
+			StrQ{`select :filter.other, :limit`, dict}.AppendExpr(nil, nil)
+		})
+	})
+}
+
+func TestArgDicts(t *testing.T) {
+	t.Run(`ArgDict`, func(t *testing.T) {
+		zero := ArgDicts(nil)
+		empty := ArgDicts{nil, Dict{}, StructDict{r.ValueOf(Void{})}}
+		full := ArgDicts{nil, Dict{}, benchDict}
+
+		eq(t, 0, zero.Len())
+		eq(t, 0, empty.Len())
+		eq(t, 24, full.Len())
+
+		testArgDictNamed(t, zero, empty, full)
+	})
+
+	dicts := ArgDicts{
+		List{10, 20},
+		nil,
+		Dict{`one`: 30},
+		List{40, 50, 60},
+		StructDict{r.ValueOf(PairStruct{`one`, `two`})},
+		LaxDict{`one`: 70, `three`: 80},
+	}
+
+	eq(t, false, dicts.IsEmpty())
+	eq(t, 3, dicts.Len())
+
+	test := func(key any, exp any) {
+		t.Helper()
+
+		var val any
+		var ok bool
+		switch key := key.(type) {
+		case int:
+			val, ok = dicts.GotOrdinal(key)
+		case string:
+			val, ok = dicts.GotNamed(key)
+		}
+
+		eq(t, exp != nil, ok)
+		eq(t, exp, val)
+	}
+
+	test(0, 10)
+	test(1, 20)
+	test(2, 60)
+	test(3, nil)
+	test(`one`, 30)
+	test(`One`, `one`)
+	test(`Two`, `two`)
+	test(`three`, 80)
+	test(`four`, nil)
+
+	t.Run(`RangeOrdinal`, func(t *testing.T) {
+		var out []int
+		dicts.RangeOrdinal(func(key int) { out = append(out, key) })
+		eq(t, []int{0, 1, 2}, out)
+	})
+
+	t.Run(`RangeNamed`, func(t *testing.T) {
+		var out []string
+		ArgDicts{Dict{`one`: 10}, LaxDict{`two`: 20}, Dict{`one`: 30}}.RangeNamed(func(key string) {
+			out = append(out, key)
+		})
+		eq(t, []string{`one`}, out)
+	})
+
+	t.Run(`StrQ`, func(t *testing.T) {
+		testExpr(
+			t,
+			rei(`select $1, $2, $3, $1`, 10, 30, `one`),
+			StrQ{`select $1, :one, :One, $1`, ArgDicts{List{10}, Dict{`one`: 30}, StructDict{r.ValueOf(PairStruct{`one`, `two`})}}},
+		)
+
+		testExpr(
+			t,
+			rei(`select $1, $2`, 10, 80),
+			StrQ{`select :one, :three`, ArgDicts{Dict{`one`: 10}, Dict{`one`: 20}, LaxDict{`three`: 80, `four`: 90}}},
+		)
+
+		panics(t, `unused named argument ":two"`, func() {
+			StrQ{`select :one`, ArgDicts{Dict{`one`: 10}, Dict{`two`: 20}}}.AppendExpr(nil, nil)
+		})
+
+		panics(t, `unused ordinal argument "$2"`, func() {
+			StrQ{`select $1`, ArgDicts{List{10}, List{20, 30}}}.AppendExpr(nil, nil)
+		})
+
+		panics(t, `missing named argument ":two"`, func() {
+			StrQ{`select :one, :two`, ArgDicts{Dict{`one`: 10}, List{20}}}.AppendExpr(nil, nil)
+		})
+	})
+}
+
 type ArgDictMap interface {
 	ArgDict
 	~map[string]any
@@ -2331,3 +3660,107 @@ func TestReturningAll(t *testing.T) {
 	testExprs(t, rei(`returning *`), ReturningAll{})
 	testExprs(t, rei(`returning * returning *`), ReturningAll{}, ReturningAll{})
 }
+
+type TemplateArgs struct {
+	Id   int64
+	Name string
+}
+
+type TemplateNestedArgs struct {
+	TemplateArgs
+	Cond Expr
+}
+
+func TestTemplate(t *testing.T) {
+	t.Run(`empty`, func(t *testing.T) {
+		testExpr(t, rei(``), NewTemplate[struct{}](``).Q(struct{}{}))
+		testExpr(t, rei(`select 1`), NewTemplate[struct{}](`select 1`).Q(struct{}{}))
+	})
+
+	t.Run(`params`, func(t *testing.T) {
+		tpl := NewTemplate[TemplateArgs](`select :Id, :Name, :Id::text`)
+		eq(t, `select :Id, :Name, :Id::text`, tpl.String())
+
+		testExpr(
+			t,
+			rei(`select $1, $2, $1::text`, int64(10), `one`),
+			tpl.Q(TemplateArgs{10, `one`}),
+		)
+
+		testExpr(
+			t,
+			rei(`select $1, $2, $1::text`, int64(20), `two`),
+			tpl.Q(TemplateArgs{20, `two`}),
+		)
+	})
+
+	t.Run(`nested`, func(t *testing.T) {
+		tpl := NewTemplate[TemplateNestedArgs](
+			`select * from users where id = :Id and name = :Name and :Cond and :Cond`,
+		)
+
+		testExpr(
+			t,
+			rei(
+				`select * from users where id = $1 and name = $2 and ("active") = $3 and ("active") = $4`,
+				int64(10), `one`, true, true,
+			),
+			tpl.Q(TemplateNestedArgs{TemplateArgs{10, `one`}, Eq{Ident(`active`), true}}),
+		)
+	})
+
+	t.Run(`composed`, func(t *testing.T) {
+		tpl := NewTemplate[TemplateArgs](`id = :Id and name = :Name`)
+
+		testExprs(
+			t,
+			rei(`select $1, id = $2 and name = $3`, `one`, int64(10), `two`),
+			StrQ{`select :val,`, Dict{`val`: `one`}},
+			tpl.Q(TemplateArgs{10, `two`}),
+		)
+	})
+
+	t.Run(`dotted`, func(t *testing.T) {
+		testExpr(
+			t,
+			rei(`select $1.col, $2`, int64(10), `one`),
+			NewTemplate[TemplateArgs](`select :Id.col, :Name`).Q(TemplateArgs{10, `one`}),
+		)
+	})
+
+	t.Run(`equivalent_to_StructQ`, func(t *testing.T) {
+		const src = `select :Name where :Id = :Id`
+		args := TemplateArgs{10, `one`}
+		eq(t, reify(StructQ(src, args)), reify(NewTemplate[TemplateArgs](src).Q(args)))
+	})
+}
+
+func TestTemplate_invalid(t *testing.T) {
+	panics(t, `expected struct, found int`, func() {
+		NewTemplate[int](``)
+	})
+
+	panics(t, `unsupported ordinal parameter "$1"`, func() {
+		NewTemplate[TemplateArgs](`select :Id, :Name, $1`)
+	})
+
+	panics(t, `named parameter ":Other" has no corresponding field at line 2, column 4`, func() {
+		NewTemplate[TemplateArgs]("select :Id, :Name,\n\t\t\t:Other")
+	})
+
+	panics(t, `field "Name" is not used by any named parameter`, func() {
+		NewTemplate[TemplateArgs](`select :Id`)
+	})
+
+	panics(t, `field "Cond" is not used by any named parameter`, func() {
+		NewTemplate[TemplateNestedArgs](`select :Id, :Name`)
+	})
+
+	panics(t, `named parameter ":GetOne" has no corresponding field`, func() {
+		NewTemplate[TrioStruct](`select :One, :Two, :Three, :GetOne`)
+	})
+
+	panics(t, `expected closing`, func() {
+		NewTemplate[TemplateArgs](`select ':Id`)
+	})
+}